@@ -9,9 +9,14 @@ import (
 )
 
 func main() {
-	config, err := telemetry.LoadConfig("config.json")
+	filename := os.Getenv("TELEMETRY_CONFIG")
+	if filename == "" {
+		filename = "config.json"
+	}
+
+	config, err := telemetry.LoadConfig(filename)
 	if err != nil {
-		fmt.Printf("failed to load config")
+		fmt.Printf("failed to load config: %v\n", err)
 		os.Exit(1)
 	}
 
@@ -46,6 +51,12 @@ func main() {
 		os.Exit(1)
 	}
 
+	err = logger.InfoFields("This is a message with typed fields", []telemetry.Field{telemetry.Int("cpu_percent", 69), telemetry.Bool("throttled", false)}, transactionID)
+	if err != nil {
+		fmt.Println("Failed info message")
+		os.Exit(1)
+	}
+
 	err = logger.Warning("This is a warning message", map[string]string{"CPU": "CPU usage is at 69%"})
 	if err != nil {
 		fmt.Println("failed warning message")
@@ -0,0 +1,22 @@
+// Command schema prints the JSON Schema of config files with all drivers,
+// for editors to validate against:
+//
+//	go run ./cmd/schema > config.schema.json
+package main
+
+import (
+	"fmt"
+	"os"
+
+	_ "github.com/annwyl/telemetry/drivers"
+	"github.com/annwyl/telemetry/telemetry"
+)
+
+func main() {
+	schema, err := telemetry.ConfigSchema()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to build schema: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(string(schema))
+}
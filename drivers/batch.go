@@ -0,0 +1,173 @@
+package drivers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/annwyl/telemetry/telemetry"
+)
+
+// StatusError is a non-2xx response from an HTTP backend, 429 and 5xx are
+// worth retrying.
+type StatusError struct {
+	Backend    string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s gave non-2xx status: %d", e.Backend, e.StatusCode)
+}
+
+func (e *StatusError) Retryable() bool {
+	return retryableStatus(e.StatusCode)
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// batchEntry is a log together with its encoded form, drivers encode when
+// the entry is added so the batch size in bytes is known.
+type batchEntry struct {
+	log  telemetry.Log
+	data []byte
+}
+
+// batcher collects entries for drivers that send them in batches. A batch
+// is sent once maxEntries entries or maxBytes bytes are pending, or the
+// interval has passed. Errors from background sends are kept until they can
+// be returned from add or Flush.
+type batcher struct {
+	maxEntries int
+	maxBytes   int
+	send       func(entries []batchEntry) error
+
+	mutex       sync.Mutex
+	entries     []batchEntry
+	size        int
+	undelivered []telemetry.Log
+	err         error
+
+	sendMutex sync.Mutex
+	closeOnce sync.Once
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+func newBatcher(maxEntries, maxBytes int, interval time.Duration, send func(entries []batchEntry) error) *batcher {
+	b := &batcher{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		send:       send,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go b.run(interval)
+	return b
+}
+
+func (b *batcher) run(interval time.Duration) {
+	defer close(b.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := b.flush()
+			b.mutex.Lock()
+			b.keep(err)
+			b.mutex.Unlock()
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+func (b *batcher) add(log telemetry.Log, data []byte) error {
+	b.mutex.Lock()
+	b.entries = append(b.entries, batchEntry{log: log, data: data})
+	b.size += len(data)
+	if len(b.entries) < b.maxEntries && (b.maxBytes <= 0 || b.size < b.maxBytes) {
+		defer b.mutex.Unlock()
+		return b.take()
+	}
+	b.mutex.Unlock()
+
+	return b.Flush()
+}
+
+// Flush sends all pending entries. Errors from earlier background flushes
+// that weren't reported yet are returned as well.
+func (b *batcher) Flush() error {
+	err := b.flush()
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.keep(err)
+	return b.take()
+}
+
+func (b *batcher) flush() error {
+	b.sendMutex.Lock()
+	defer b.sendMutex.Unlock()
+
+	b.mutex.Lock()
+	if len(b.entries) == 0 {
+		b.mutex.Unlock()
+		return nil
+	}
+	entries := b.entries
+	b.entries = nil
+	b.size = 0
+	b.mutex.Unlock()
+
+	return b.send(entries)
+}
+
+// keep holds on to a flush error until it can be returned from add or Flush.
+func (b *batcher) keep(err error) {
+	if err == nil {
+		return
+	}
+
+	var undelivered *telemetry.UndeliveredError
+	if errors.As(err, &undelivered) {
+		b.undelivered = append(b.undelivered, undelivered.Logs...)
+		err = undelivered.Err
+	}
+	b.err = errors.Join(b.err, err)
+}
+
+func (b *batcher) take() error {
+	if b.err == nil {
+		return nil
+	}
+
+	var err error = &telemetry.UndeliveredError{Logs: b.undelivered, Err: b.err}
+	if len(b.undelivered) == 0 {
+		err = b.err
+	}
+	b.undelivered = nil
+	b.err = nil
+	return err
+}
+
+// close stops the background flushes and sends what is left.
+func (b *batcher) close() error {
+	b.closeOnce.Do(func() { close(b.stop) })
+	<-b.done
+	return b.Flush()
+}
+
+func logsOf(entries []batchEntry) []telemetry.Log {
+	logs := make([]telemetry.Log, len(entries))
+	for i, entry := range entries {
+		logs[i] = entry.log
+	}
+	return logs
+}
@@ -2,16 +2,53 @@ package drivers
 
 import (
 	"encoding/json"
-	"fmt"
+	"io"
+	"os"
+	"sync"
 
 	"github.com/annwyl/telemetry/telemetry"
 )
 
-type ConsoleDriver struct{}
+// consoleConfig picks the output stream and the format. The default pretty
+// format is laid out by Layout, a list of the columns time, level,
+// transaction, message and tags.
+type consoleConfig struct {
+	telemetry.FormatConfig
+	Output              string `json:"output" jsonschema:"enum=stdout|stderr"`
+	Color               string `json:"color" jsonschema:"enum=auto|always|never"`
+	Layout              string `json:"layout"`
+	TransactionIDLength int    `json:"transaction_id_length"`
+}
+
+// UnmarshalJSON ignores plain strings, older configs pass a filename the
+// console driver never used.
+func (c *consoleConfig) UnmarshalJSON(data []byte) error {
+	var ignored string
+	if err := json.Unmarshal(data, &ignored); err == nil {
+		return nil
+	}
+
+	type plain consoleConfig
+	return json.Unmarshal(data, (*plain)(c))
+}
+
+// ConsoleDriver writes one formatted line per log to stdout or stderr.
+type ConsoleDriver struct {
+	formatter telemetry.Formatter
+	out       io.Writer
+	mutex     sync.Mutex
+}
 
 func (c *ConsoleDriver) Log(log telemetry.Log) error {
-	fmt.Println(log)
-	return nil
+	line, err := c.formatter.Format(log)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	_, err = c.out.Write(line)
+	return err
 }
 
 func (c *ConsoleDriver) Close() error {
@@ -19,10 +56,72 @@ func (c *ConsoleDriver) Close() error {
 }
 
 func init() {
-	err := telemetry.RegisterDriver("console", func(_ json.RawMessage) (telemetry.Driver, error) {
-		return &ConsoleDriver{}, nil
+	err := telemetry.RegisterDriver("console", func(config json.RawMessage) (telemetry.Driver, error) {
+		var cfg consoleConfig
+		if len(config) > 0 && string(config) != "null" {
+			if err := telemetry.DecodeStrict(config, &cfg); err != nil {
+				return nil, err
+			}
+		}
+		return newConsoleDriver(cfg, os.Getenv)
 	})
 	if err != nil {
 		panic(err)
 	}
+	err = telemetry.RegisterDriverValidator("console", strictValidator(func() driverConfig { return &consoleConfig{} }))
+	if err != nil {
+		panic(err)
+	}
+	err = telemetry.RegisterDriverSchema("console", stringOrSchema(telemetry.SchemaFor(consoleConfig{})))
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (c consoleConfig) validate() error {
+	var errs telemetry.ConfigErrors
+	switch c.Output {
+	case "", "stdout", "stderr":
+	default:
+		errs.Add("output", "invalid console output %q (must be stdout or stderr)", c.Output)
+	}
+	if _, err := useColor(c.Color, nil, func(string) string { return "" }); err != nil {
+		errs.Add("color", "%v", err)
+	}
+	if c.Format == "" || c.Format == "pretty" {
+		if _, err := newPrettyFormatter(c.Layout, c.TimeFormat, c.TransactionIDLength, false); err != nil {
+			errs.Add("layout", "%v", err)
+		}
+	} else if _, err := telemetry.NewFormatter(c.FormatConfig, "text"); err != nil {
+		errs.Add("format", "%v", err)
+	}
+	return errs.Err()
+}
+
+func newConsoleDriver(cfg consoleConfig, getenv func(string) string) (*ConsoleDriver, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	out := os.Stdout
+	if cfg.Output == "stderr" {
+		out = os.Stderr
+	}
+
+	color, err := useColor(cfg.Color, out, getenv)
+	if err != nil {
+		return nil, err
+	}
+
+	var formatter telemetry.Formatter
+	if cfg.Format == "" || cfg.Format == "pretty" {
+		formatter, err = newPrettyFormatter(cfg.Layout, cfg.TimeFormat, cfg.TransactionIDLength, color)
+	} else {
+		formatter, err = telemetry.NewFormatter(cfg.FormatConfig, "text")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &ConsoleDriver{formatter: formatter, out: out}, nil
 }
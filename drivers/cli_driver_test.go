@@ -0,0 +1,118 @@
+package drivers
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/annwyl/telemetry/telemetry"
+)
+
+var prettyTestLog = telemetry.Log{
+	Timestamp:     time.Date(2024, 3, 1, 12, 30, 5, 42000000, time.UTC),
+	Level:         telemetry.WarningLevel,
+	Message:       "cache miss",
+	Tags:          map[string]string{"region": "eu west", "app": "api"},
+	Fields:        telemetry.Fields{telemetry.Int("attempt", 2)},
+	TransactionID: "4bf92f3577b34da6a3ce929d0e0e4736",
+}
+
+func TestPrettyFormatter(t *testing.T) {
+	formatter, err := newPrettyFormatter("", "", 0, false)
+	if err != nil {
+		t.Fatalf("newPrettyFormatter returned error: %v", err)
+	}
+
+	line, _ := formatter.Format(prettyTestLog)
+	want := `12:30:05.042 WARN  [4bf92f35] cache miss                               app=api attempt=2 region="eu west"` + "\n"
+	if string(line) != want {
+		t.Errorf("unexpected line\nwant %q\ngot  %q", want, line)
+	}
+
+	line, _ = formatter.Format(telemetry.Log{Timestamp: prettyTestLog.Timestamp, Level: telemetry.InfoLevel, Message: "started"})
+	if string(line) != "12:30:05.042 INFO             started\n" {
+		t.Errorf("unexpected line without tags %q", line)
+	}
+
+	untracked := prettyTestLog
+	untracked.TransactionID = ""
+	line, _ = formatter.Format(untracked)
+	want = `12:30:05.042 WARN             cache miss                               app=api attempt=2 region="eu west"` + "\n"
+	if string(line) != want {
+		t.Errorf("wanted the columns lined up without a transaction\nwant %q\ngot  %q", want, line)
+	}
+}
+
+func TestPrettyFormatterLayout(t *testing.T) {
+	formatter, err := newPrettyFormatter("level message transaction", "", -1, true)
+	if err != nil {
+		t.Fatalf("newPrettyFormatter returned error: %v", err)
+	}
+
+	line, _ := formatter.Format(prettyTestLog)
+	want := colorYellow + "WARN " + colorReset + " cache miss                               " + colorFaint + "[4bf92f3577b34da6a3ce929d0e0e4736]" + colorReset + "\n"
+	if string(line) != want {
+		t.Errorf("unexpected line\nwant %q\ngot  %q", want, line)
+	}
+
+	if _, err := newPrettyFormatter("time caller", "", 0, false); err == nil {
+		t.Error("wanted error for unknown column")
+	}
+}
+
+func TestUseColor(t *testing.T) {
+	tests := []struct {
+		name string
+		mode string
+		env  map[string]string
+		want bool
+	}{
+		{name: "not a terminal", want: false},
+		{name: "always", mode: "always", env: map[string]string{"NO_COLOR": "1"}, want: true},
+		{name: "never", mode: "never", env: map[string]string{"FORCE_COLOR": "1"}, want: false},
+		{name: "force color", env: map[string]string{"FORCE_COLOR": "1"}, want: true},
+		{name: "force color off", env: map[string]string{"FORCE_COLOR": "0"}, want: false},
+		{name: "no color", mode: "auto", env: map[string]string{"NO_COLOR": "1"}, want: false},
+	}
+
+	// a pipe is never a terminal
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("pipe returned error: %v", err)
+	}
+	defer reader.Close()
+	defer writer.Close()
+
+	for _, tt := range tests {
+		getenv := func(key string) string { return tt.env[key] }
+		got, err := useColor(tt.mode, writer, getenv)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: wanted %v, got %v %v", tt.name, tt.want, got, err)
+		}
+	}
+
+	if _, err := useColor("sometimes", writer, os.Getenv); err == nil {
+		t.Error("wanted error for unknown color mode")
+	}
+}
+
+func TestConsoleDriver(t *testing.T) {
+	if _, err := newConsoleDriver(consoleConfig{Output: "printer"}, os.Getenv); err == nil {
+		t.Error("wanted error for unknown output")
+	}
+
+	driver, err := newConsoleDriver(consoleConfig{FormatConfig: telemetry.FormatConfig{Format: "json"}, Output: "stderr"}, os.Getenv)
+	if err != nil {
+		t.Fatalf("newConsoleDriver returned error: %v", err)
+	}
+	var out bytes.Buffer
+	driver.out = &out
+
+	if err := driver.Log(prettyTestLog); err != nil {
+		t.Fatalf("log returned error: %v", err)
+	}
+	if !bytes.HasPrefix(out.Bytes(), []byte(`{"timestamp":`)) {
+		t.Errorf("wanted json line, got %s", out.String())
+	}
+}
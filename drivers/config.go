@@ -0,0 +1,44 @@
+package drivers
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/annwyl/telemetry/telemetry"
+)
+
+// driverConfig is implemented by the driver_config types, validate reports
+// problems as telemetry.ConfigErrors with paths inside the driver_config.
+type driverConfig interface {
+	validate() error
+}
+
+// strictValidator decodes a driver_config strictly into the value that
+// newConfig returns and validates it, without creating the driver. Unknown
+// fields are reported together with the problems validate finds.
+func strictValidator(newConfig func() driverConfig) telemetry.DriverValidator {
+	return func(config json.RawMessage) error {
+		cfg := newConfig()
+		err := telemetry.DecodeStrict(config, cfg)
+		if json.Unmarshal(config, newConfig()) != nil {
+			// the values after the broken one are missing, checking them
+			// would only add noise
+			return err
+		}
+
+		var errs telemetry.ConfigErrors
+		errors.As(err, &errs)
+		if err := cfg.validate(); err != nil {
+			var invalid telemetry.ConfigErrors
+			errors.As(err, &invalid)
+			errs = append(errs, invalid...)
+		}
+		return errs.Err()
+	}
+}
+
+// stringOrSchema also accepts a plain string, for drivers that take a
+// filename instead of an object.
+func stringOrSchema(schema json.RawMessage) json.RawMessage {
+	return json.RawMessage(`{"anyOf":[{"type":"string"},` + string(schema) + `]}`)
+}
@@ -0,0 +1,104 @@
+package drivers
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/annwyl/telemetry/telemetry"
+)
+
+func TestDriverSchemas(t *testing.T) {
+	data, err := telemetry.ConfigSchema()
+	if err != nil {
+		t.Fatalf("configschema returned error: %v", err)
+	}
+
+	var schema struct {
+		Definitions struct {
+			Driver struct {
+				AllOf []struct {
+					If struct {
+						Properties struct {
+							Driver struct {
+								Const string `json:"const"`
+							} `json:"driver"`
+						} `json:"properties"`
+					} `json:"if"`
+				} `json:"allOf"`
+			} `json:"driver"`
+		} `json:"definitions"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("schema isn't valid json: %v", err)
+	}
+
+	withSchema := make(map[string]bool)
+	for _, condition := range schema.Definitions.Driver.AllOf {
+		withSchema[condition.If.Properties.Driver.Const] = true
+	}
+	for _, name := range []string{"console", "file", "json", "elasticsearch", "otlp", "syslog", "multi"} {
+		if !withSchema[name] {
+			t.Errorf("wanted a schema for the %s driver", name)
+		}
+	}
+}
+
+func TestDriverValidators(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.yaml")
+	content := `
+driver: multi
+driver_config:
+  drivers:
+    - driver: console
+      driver_config: {output: stdout, colour: never}
+    - driver: elasticsearch
+      driver_config: {host: "http://localhost:9200", usrname: elastic}
+    - driver: syslog
+      driver_config: {network: tcp, facility: kernel}
+    - driver: missing
+      driver_config: {}
+log_level: info
+`
+	if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := telemetry.LoadConfig(filename)
+	var configErrors telemetry.ConfigErrors
+	if !errors.As(err, &configErrors) {
+		t.Fatalf("wanted ConfigErrors, got %v", err)
+	}
+
+	var paths []string
+	for _, configError := range configErrors {
+		paths = append(paths, configError.Path)
+	}
+	want := []string{
+		"driver_config.drivers[0].driver_config.colour",
+		"driver_config.drivers[1].driver_config.usrname",
+		"driver_config.drivers[1].driver_config.index",
+		"driver_config.drivers[2].driver_config.address",
+		"driver_config.drivers[2].driver_config.facility",
+		"driver_config.drivers[3].driver",
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("wanted paths %v, got %v", want, paths)
+	}
+}
+
+func TestStrictFactories(t *testing.T) {
+	_, err := telemetry.NewDriver("elasticsearch", json.RawMessage(`{"host": "http://localhost:9200", "index": "logs", "usrname": "elastic"}`))
+	if err == nil {
+		t.Error("wanted error for unknown field when creating the driver")
+	}
+
+	driver, err := telemetry.NewDriver("file", json.RawMessage(`"`+filepath.Join(t.TempDir(), "logs.txt")+`"`))
+	if err != nil {
+		t.Fatalf("wanted plain filename accepted, got %v", err)
+	}
+	driver.Close()
+}
@@ -1,6 +1,7 @@
 package drivers
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -10,44 +11,135 @@ import (
 	"github.com/annwyl/telemetry/telemetry"
 )
 
+const (
+	defaultBulkActions   = 500
+	defaultBulkSize      = 5 << 20
+	defaultFlushInterval = 5 * time.Second
+)
+
+type elasticsearchConfig struct {
+	Host          string                 `json:"host" jsonschema:"required"`
+	Index         string                 `json:"index" jsonschema:"required"`
+	Username      string                 `json:"username"`
+	Password      string                 `json:"password"`
+	BulkActions   int                    `json:"bulk_actions"`
+	BulkSize      int                    `json:"bulk_size"`
+	FlushInterval telemetry.JSONDuration `json:"flush_interval"`
+}
+
+// ElasticsearchDriver collects documents and sends them to the _bulk
+// endpoint once bulk_actions documents or bulk_size bytes are pending, or
+// flush_interval has passed.
 type ElasticsearchDriver struct {
-	client *http.Client
-	url    string
-	index  string
-	auth   string
+	client   *http.Client
+	url      string
+	index    string
+	username string
+	password string
+	batcher  *batcher
 }
 
-func init() {
-	err := telemetry.RegisterDriver("elasticsearch", func(config json.RawMessage) (telemetry.Driver, error) {
-		var cfg struct {
-			Host     string `json:"host"`
-			Index    string `json:"index"`
-			Username string `json:"username"`
-			Password string `json:"password"`
-		}
-		if err := json.Unmarshal(config, &cfg); err != nil {
-			return nil, err
-		}
+// BulkItemError is a single document the _bulk endpoint refused.
+type BulkItemError struct {
+	Position int
+	Status   int
+	Type     string
+	Reason   string
+}
 
-		if cfg.Host == "" || cfg.Index == "" {
-			return nil, fmt.Errorf("elasticsearch host and index required")
-		}
+func (e BulkItemError) Error() string {
+	return fmt.Sprintf("document %d: status %d: %s: %s", e.Position, e.Status, e.Type, e.Reason)
+}
 
-		driver := &ElasticsearchDriver{
-			client: &http.Client{},
-			url:    fmt.Sprintf("%s/%s/_doc", cfg.Host, cfg.Index),
-			index:  cfg.Index,
-		}
+// BulkError is returned when part of a bulk request failed.
+type BulkError struct {
+	Total  int
+	Failed []BulkItemError
+}
+
+func (e *BulkError) Error() string {
+	reasons := make([]string, len(e.Failed))
+	for i, item := range e.Failed {
+		reasons[i] = item.Error()
+	}
+	return fmt.Sprintf("elasticsearch bulk: %d of %d documents failed: %s", len(e.Failed), e.Total, strings.Join(reasons, "; "))
+}
 
-		if cfg.Username != "" && cfg.Password != "" {
-			driver.auth = fmt.Sprintf("%s:%s", cfg.Username, cfg.Password)
+// Retryable reports whether every failed document was refused with a status
+// that is worth retrying.
+func (e *BulkError) Retryable() bool {
+	for _, item := range e.Failed {
+		if !retryableStatus(item.Status) {
+			return false
 		}
+	}
+	return true
+}
 
-		return driver, nil
+func init() {
+	err := telemetry.RegisterDriver("elasticsearch", func(config json.RawMessage) (telemetry.Driver, error) {
+		var cfg elasticsearchConfig
+		if err := telemetry.DecodeStrict(config, &cfg); err != nil {
+			return nil, err
+		}
+		return newElasticsearchDriver(cfg)
 	})
 	if err != nil {
 		panic(err)
 	}
+	err = telemetry.RegisterDriverValidator("elasticsearch", strictValidator(func() driverConfig { return &elasticsearchConfig{} }))
+	if err != nil {
+		panic(err)
+	}
+	err = telemetry.RegisterDriverSchema("elasticsearch", telemetry.SchemaFor(elasticsearchConfig{}))
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (c elasticsearchConfig) validate() error {
+	var errs telemetry.ConfigErrors
+	if c.Host == "" {
+		errs.Add("host", "elasticsearch host required")
+	}
+	if c.Index == "" {
+		errs.Add("index", "elasticsearch index required")
+	}
+	return errs.Err()
+}
+
+func newElasticsearchDriver(cfg elasticsearchConfig) (*ElasticsearchDriver, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	driver := &ElasticsearchDriver{
+		client: &http.Client{},
+		url:    fmt.Sprintf("%s/%s/_bulk", strings.TrimSuffix(cfg.Host, "/"), cfg.Index),
+		index:  cfg.Index,
+	}
+
+	if cfg.Username != "" && cfg.Password != "" {
+		driver.username = cfg.Username
+		driver.password = cfg.Password
+	}
+
+	maxActions := cfg.BulkActions
+	if maxActions <= 0 {
+		maxActions = defaultBulkActions
+	}
+	maxBytes := cfg.BulkSize
+	if maxBytes <= 0 {
+		maxBytes = defaultBulkSize
+	}
+
+	interval := time.Duration(cfg.FlushInterval)
+	if interval <= 0 {
+		interval = defaultFlushInterval
+	}
+	driver.batcher = newBatcher(maxActions, maxBytes, interval, driver.send)
+
+	return driver, nil
 }
 
 func (e *ElasticsearchDriver) Log(log telemetry.Log) error {
@@ -55,40 +147,105 @@ func (e *ElasticsearchDriver) Log(log telemetry.Log) error {
 		"timestamp": log.Timestamp.Format(time.RFC3339),
 		"level":     log.Level,
 		"message":   log.Message,
-		"tags":      log.Tags,
+		"tags":      log.Values(),
 	}
 	if log.TransactionID != "" {
 		logData["transaction_id"] = log.TransactionID
 	}
+	if log.ParentID != "" {
+		logData["parent_id"] = log.ParentID
+	}
+	if log.TraceID != "" {
+		logData["trace_id"] = log.TraceID
+	}
 
 	payload, err := json.Marshal(logData)
 	if err != nil {
 		return err
 	}
 
-	req, err := http.NewRequest("POST", e.url, strings.NewReader(string(payload)))
+	line := make([]byte, 0, len(payload)+14)
+	line = append(line, "{\"index\":{}}\n"...)
+	line = append(line, payload...)
+	line = append(line, '\n')
+	return e.batcher.add(log, line)
+}
+
+// Flush sends all pending documents. Errors from earlier background flushes
+// that weren't reported yet are returned as well.
+func (e *ElasticsearchDriver) Flush() error {
+	return e.batcher.Flush()
+}
+
+func (e *ElasticsearchDriver) send(entries []batchEntry) error {
+	var body bytes.Buffer
+	for _, entry := range entries {
+		body.Write(entry.data)
+	}
+	logs := logsOf(entries)
+
+	req, err := http.NewRequest("POST", e.url, &body)
 	if err != nil {
 		return err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	if e.auth != "" {
-		req.SetBasicAuth(strings.Split(e.auth, ":")[0], strings.Split(e.auth, ":")[1])
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if e.username != "" {
+		req.SetBasicAuth(e.username, e.password)
 	}
 
 	resp, err := e.client.Do(req)
 	if err != nil {
-		return err
+		return &telemetry.UndeliveredError{Logs: logs, Err: err}
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 300 {
-		return fmt.Errorf("elasticsearch gave non-2xx status: %d", resp.StatusCode)
+		return &telemetry.UndeliveredError{Logs: logs, Err: &StatusError{Backend: "elasticsearch", StatusCode: resp.StatusCode}}
 	}
 
-	return nil
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int `json:"status"`
+			Error  *struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return &telemetry.UndeliveredError{Logs: logs, Err: fmt.Errorf("failed to decode elasticsearch bulk response: %v", err)}
+	}
+
+	if !result.Errors {
+		return nil
+	}
+
+	bulkErr := &BulkError{Total: len(logs)}
+	var failed []telemetry.Log
+	for i, item := range result.Items {
+		for _, action := range item {
+			if action.Error == nil && action.Status < 300 {
+				continue
+			}
+			itemErr := BulkItemError{Position: i, Status: action.Status}
+			if action.Error != nil {
+				itemErr.Type = action.Error.Type
+				itemErr.Reason = action.Error.Reason
+			}
+			bulkErr.Failed = append(bulkErr.Failed, itemErr)
+			if i < len(logs) {
+				failed = append(failed, logs[i])
+			}
+		}
+	}
+	if len(bulkErr.Failed) == 0 {
+		return nil
+	}
+	return &telemetry.UndeliveredError{Logs: failed, Err: bulkErr}
 }
 
 func (e *ElasticsearchDriver) Close() error {
-	return nil
+	return e.batcher.close()
 }
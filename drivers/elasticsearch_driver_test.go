@@ -0,0 +1,280 @@
+package drivers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/annwyl/telemetry/telemetry"
+)
+
+type bulkServer struct {
+	mu       sync.Mutex
+	requests [][]map[string]interface{}
+	respond  func(lines int) string
+}
+
+func (b *bulkServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/logs/_bulk" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Header.Get("Content-Type") != "application/x-ndjson" {
+		http.Error(w, "wrong content type", http.StatusBadRequest)
+		return
+	}
+
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(r.Body)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		lines = append(lines, line)
+	}
+
+	b.mu.Lock()
+	b.requests = append(b.requests, lines)
+	b.mu.Unlock()
+
+	if b.respond != nil {
+		w.Write([]byte(b.respond(len(lines))))
+		return
+	}
+	w.Write([]byte(`{"errors":false,"items":[]}`))
+}
+
+func (b *bulkServer) count() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.requests)
+}
+
+func TestElasticsearchBulkByCount(t *testing.T) {
+	handler := &bulkServer{}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	driver, err := newElasticsearchDriver(elasticsearchConfig{
+		Host:          server.URL,
+		Index:         "logs",
+		BulkActions:   3,
+		FlushInterval: telemetry.JSONDuration(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("newElasticsearchDriver returned error: %v", err)
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := driver.Log(telemetry.Log{Message: "bulk", Tags: map[string]string{"n": "x"}}); err != nil {
+			t.Fatalf("log returned error: %v", err)
+		}
+	}
+
+	if handler.count() != 1 {
+		t.Fatalf("wanted 1 bulk request after 3 documents, got %d", handler.count())
+	}
+	if lines := handler.requests[0]; len(lines) != 6 {
+		t.Fatalf("wanted 6 ndjson lines, got %d", len(lines))
+	}
+	if _, ok := handler.requests[0][0]["index"]; !ok {
+		t.Errorf("wanted index action line, got %v", handler.requests[0][0])
+	}
+	if handler.requests[0][1]["message"] != "bulk" {
+		t.Errorf("wanted document line, got %v", handler.requests[0][1])
+	}
+
+	if err := driver.Close(); err != nil {
+		t.Fatalf("close returned error: %v", err)
+	}
+	if handler.count() != 2 {
+		t.Errorf("wanted pending document flushed on close, got %d requests", handler.count())
+	}
+}
+
+func TestElasticsearchNativeFieldTypes(t *testing.T) {
+	handler := &bulkServer{}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	driver, err := newElasticsearchDriver(elasticsearchConfig{
+		Host:          server.URL,
+		Index:         "logs",
+		FlushInterval: telemetry.JSONDuration(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("newElasticsearchDriver returned error: %v", err)
+	}
+
+	driver.Log(telemetry.Log{
+		Message: "typed",
+		Tags:    map[string]string{"environment": "test"},
+		Fields:  telemetry.Fields{telemetry.Int("status", 200), telemetry.Duration("latency", 2*time.Millisecond)},
+	})
+	if err := driver.Close(); err != nil {
+		t.Fatalf("close returned error: %v", err)
+	}
+
+	tags, ok := handler.requests[0][1]["tags"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("wanted tags object, got %v", handler.requests[0][1])
+	}
+	if tags["status"] != float64(200) || tags["latency"] != float64(2) || tags["environment"] != "test" {
+		t.Errorf("wanted native JSON values, got %v", tags)
+	}
+}
+
+func TestElasticsearchBulkBySize(t *testing.T) {
+	handler := &bulkServer{}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	driver, err := newElasticsearchDriver(elasticsearchConfig{
+		Host:          server.URL,
+		Index:         "logs",
+		BulkSize:      100,
+		FlushInterval: telemetry.JSONDuration(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("newElasticsearchDriver returned error: %v", err)
+	}
+	defer driver.Close()
+
+	driver.Log(telemetry.Log{Message: "this message is long enough to go past the one hundred byte bulk size limit"})
+
+	if handler.count() != 1 {
+		t.Errorf("wanted flush when bulk size is reached, got %d requests", handler.count())
+	}
+}
+
+func TestElasticsearchBulkByInterval(t *testing.T) {
+	handler := &bulkServer{}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	driver, err := newElasticsearchDriver(elasticsearchConfig{
+		Host:          server.URL,
+		Index:         "logs",
+		FlushInterval: telemetry.JSONDuration(10 * time.Millisecond),
+	})
+	if err != nil {
+		t.Fatalf("newElasticsearchDriver returned error: %v", err)
+	}
+	defer driver.Close()
+
+	driver.Log(telemetry.Log{Message: "tick"})
+
+	deadline := time.Now().Add(time.Second)
+	for handler.count() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if handler.count() != 1 {
+		t.Errorf("wanted flush after interval, got %d requests", handler.count())
+	}
+}
+
+func TestElasticsearchBulkItemErrors(t *testing.T) {
+	handler := &bulkServer{
+		respond: func(int) string {
+			return `{"errors":true,"items":[
+				{"index":{"status":201}},
+				{"index":{"status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse field [tags.n]"}}}
+			]}`
+		},
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	driver, err := newElasticsearchDriver(elasticsearchConfig{
+		Host:          server.URL,
+		Index:         "logs",
+		FlushInterval: telemetry.JSONDuration(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("newElasticsearchDriver returned error: %v", err)
+	}
+	defer driver.Close()
+
+	driver.Log(telemetry.Log{Message: "ok"})
+	driver.Log(telemetry.Log{Message: "broken"})
+
+	err = driver.Flush()
+	var bulkErr *BulkError
+	if !errors.As(err, &bulkErr) {
+		t.Fatalf("wanted BulkError, got %v", err)
+	}
+	if bulkErr.Total != 2 || len(bulkErr.Failed) != 1 {
+		t.Fatalf("wanted 1 of 2 failed, got %d of %d", len(bulkErr.Failed), bulkErr.Total)
+	}
+	if failed := bulkErr.Failed[0]; failed.Position != 1 || failed.Status != 400 || failed.Type != "mapper_parsing_exception" {
+		t.Errorf("unexpected failed item: %+v", failed)
+	}
+	if bulkErr.Retryable() {
+		t.Error("mapping errors shouldn't be retryable")
+	}
+
+	var undelivered *telemetry.UndeliveredError
+	if !errors.As(err, &undelivered) {
+		t.Fatalf("wanted UndeliveredError, got %v", err)
+	}
+	if len(undelivered.Logs) != 1 || undelivered.Logs[0].Message != "broken" {
+		t.Errorf("wanted the broken document handed back, got %v", undelivered.Logs)
+	}
+}
+
+func TestElasticsearchBulkStatusError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	driver, err := newElasticsearchDriver(elasticsearchConfig{
+		Host:          server.URL,
+		Index:         "logs",
+		BulkActions:   1,
+		FlushInterval: telemetry.JSONDuration(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("newElasticsearchDriver returned error: %v", err)
+	}
+	defer driver.Close()
+
+	err = driver.Log(telemetry.Log{Message: "throttled"})
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("wanted StatusError 429, got %v", err)
+	}
+	if !telemetry.IsRetryable(err) {
+		t.Error("wanted 429 to be retryable")
+	}
+}
+
+func TestElasticsearchBulkDecodeError(t *testing.T) {
+	handler := &bulkServer{respond: func(int) string { return "<html>bad gateway</html>" }}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	driver, err := newElasticsearchDriver(elasticsearchConfig{
+		Host:          server.URL,
+		Index:         "logs",
+		FlushInterval: telemetry.JSONDuration(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("newElasticsearchDriver returned error: %v", err)
+	}
+	defer driver.Close()
+
+	driver.Log(telemetry.Log{Message: "unknown"})
+	err = driver.Flush()
+	var undelivered *telemetry.UndeliveredError
+	if !errors.As(err, &undelivered) || len(undelivered.Logs) != 1 {
+		t.Fatalf("wanted the batch handed back, got %v", err)
+	}
+}
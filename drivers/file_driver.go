@@ -2,37 +2,57 @@ package drivers
 
 import (
 	"encoding/json"
-	"fmt"
-	"os"
-	"time"
 
 	"github.com/annwyl/telemetry/telemetry"
 )
 
+// FileDriver writes one line per log, logfmt unless format says otherwise.
 type FileDriver struct {
-	file *os.File
+	file      *rotatingFile
+	formatter telemetry.Formatter
 }
 
 func init() {
 	err := telemetry.RegisterDriver("file", func(config json.RawMessage) (telemetry.Driver, error) {
-		var filename string
-		if err := json.Unmarshal(config, &filename); err != nil {
-			return nil, err
-		}
-
-		file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			return nil, err
-		}
-		return &FileDriver{file: file}, nil
+		return newFileDriver(config, "text")
 	})
 	if err != nil {
 		panic(err)
 	}
+	err = telemetry.RegisterDriverValidator("file", strictValidator(func() driverConfig { return &fileConfig{} }))
+	if err != nil {
+		panic(err)
+	}
+	err = telemetry.RegisterDriverSchema("file", stringOrSchema(telemetry.SchemaFor(fileConfig{})))
+	if err != nil {
+		panic(err)
+	}
+}
+
+func newFileDriver(config json.RawMessage, defaultFormat string) (*FileDriver, error) {
+	var cfg fileConfig
+	if err := telemetry.DecodeStrict(config, &cfg); err != nil {
+		return nil, err
+	}
+
+	formatter, err := telemetry.NewFormatter(cfg.FormatConfig, defaultFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := openRotatingFile(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &FileDriver{file: file, formatter: formatter}, nil
 }
 
 func (f *FileDriver) Log(log telemetry.Log) error {
-	_, err := fmt.Fprintf(f.file, "%s %d %s %s\n", log.Timestamp.Format(time.RFC3339), log.Level, log.Message, log.Tags)
+	line, err := f.formatter.Format(log)
+	if err != nil {
+		return err
+	}
+	_, err = f.file.Write(line)
 	return err
 }
 
@@ -2,41 +2,32 @@ package drivers
 
 import (
 	"encoding/json"
-	"os"
 
 	"github.com/annwyl/telemetry/telemetry"
 )
 
+// JSONDriver is the file driver writing JSON lines by default.
 type JSONDriver struct {
-	file    *os.File
-	encoder *json.Encoder
+	*FileDriver
 }
 
 func init() {
 	err := telemetry.RegisterDriver("json", func(config json.RawMessage) (telemetry.Driver, error) {
-		var filename string
-		if err := json.Unmarshal(config, &filename); err != nil {
-			return nil, err
-		}
-
-		file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		driver, err := newFileDriver(config, "json")
 		if err != nil {
 			return nil, err
 		}
-		return &JSONDriver{
-			file:    file,
-			encoder: json.NewEncoder(file),
-		}, nil
+		return &JSONDriver{FileDriver: driver}, nil
 	})
 	if err != nil {
 		panic(err)
 	}
-}
-
-func (j *JSONDriver) Log(log telemetry.Log) error {
-	return j.encoder.Encode(log)
-}
-
-func (j *JSONDriver) Close() error {
-	return j.file.Close()
+	err = telemetry.RegisterDriverValidator("json", strictValidator(func() driverConfig { return &fileConfig{} }))
+	if err != nil {
+		panic(err)
+	}
+	err = telemetry.RegisterDriverSchema("json", stringOrSchema(telemetry.SchemaFor(fileConfig{})))
+	if err != nil {
+		panic(err)
+	}
 }
@@ -0,0 +1,184 @@
+package drivers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/annwyl/telemetry/telemetry"
+)
+
+type multiChild struct {
+	driver   telemetry.Driver
+	name     string
+	logLevel telemetry.LogLevel
+}
+
+// MultiDriver fans every entry out to several child drivers, each with its
+// own minimum level. A failing child doesn't stop delivery to the others.
+// Children that should be retried get their own retry settings, so only the
+// failing child sends the entry again.
+type MultiDriver struct {
+	children []multiChild
+}
+
+// MultiError holds the errors of the children that failed. It is never
+// retryable as a whole, retrying the fan-out would send the entry again to
+// the children that got it.
+type MultiError struct {
+	Errs []error
+}
+
+func (e *MultiError) Error() string {
+	return errors.Join(e.Errs...).Error()
+}
+
+func (e *MultiError) Unwrap() []error {
+	return e.Errs
+}
+
+func (e *MultiError) Retryable() bool {
+	return false
+}
+
+type multiConfig struct {
+	Drivers []multiChildConfig `json:"drivers"`
+}
+
+type multiChildConfig struct {
+	Name     string                 `json:"driver"`
+	Config   json.RawMessage        `json:"driver_config"`
+	LogLevel telemetry.LogLevel     `json:"log_level"`
+	Retry    *telemetry.RetryConfig `json:"retry,omitempty"`
+}
+
+// validate checks every child like a top level driver_config, through the
+// validators of the child drivers.
+func (c multiConfig) validate() error {
+	var errs telemetry.ConfigErrors
+	if len(c.Drivers) == 0 {
+		errs.Add("drivers", "multi driver needs at least one child driver")
+	}
+
+	registered := telemetry.GetRegisteredDrivers()
+	for i, child := range c.Drivers {
+		path := fmt.Sprintf("drivers[%d]", i)
+		if _, ok := registered[child.Name]; !ok {
+			errs.Add(path+".driver", "unknown driver: %s", child.Name)
+			continue
+		}
+		if child.LogLevel < telemetry.TraceLevel || child.LogLevel > telemetry.FatalLevel {
+			errs.Add(path+".log_level", "invalid log level: %d", child.LogLevel)
+		}
+		errs = append(errs, telemetry.ValidateDriverConfig(child.Name, child.Config).Within(path+".driver_config")...)
+		if child.Retry != nil {
+			errs = append(errs, telemetry.ValidateRetryConfig(*child.Retry).Within(path+".retry")...)
+		}
+	}
+	return errs.Err()
+}
+
+// multiSchema checks every child like a top level driver and its config.
+var multiSchema = json.RawMessage(fmt.Sprintf(`{
+	"type": "object",
+	"properties": {
+		"drivers": {
+			"type": "array",
+			"minItems": 1,
+			"items": {
+				"allOf": [{"$ref": "#/definitions/driver"}],
+				"properties": {
+					"driver": {},
+					"driver_config": {},
+					"log_level": {"$ref": "#/definitions/level"},
+					"retry": %s
+				},
+				"additionalProperties": false
+			}
+		}
+	},
+	"required": ["drivers"],
+	"additionalProperties": false
+}`, telemetry.SchemaFor(telemetry.RetryConfig{})))
+
+func init() {
+	err := telemetry.RegisterDriver("multi", func(config json.RawMessage) (telemetry.Driver, error) {
+		var cfg multiConfig
+		if err := telemetry.DecodeStrict(config, &cfg); err != nil {
+			return nil, err
+		}
+		if err := cfg.validate(); err != nil {
+			return nil, err
+		}
+
+		multi := &MultiDriver{}
+		for _, child := range cfg.Drivers {
+			driver, err := telemetry.NewRetryingDriver(child.Name, child.Config, child.Retry)
+			if err != nil {
+				multi.Close()
+				return nil, fmt.Errorf("failed to create %s driver: %v", child.Name, err)
+			}
+			multi.children = append(multi.children, multiChild{
+				driver:   driver,
+				name:     child.Name,
+				logLevel: child.LogLevel,
+			})
+		}
+		return multi, nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	err = telemetry.RegisterDriverValidator("multi", strictValidator(func() driverConfig { return &multiConfig{} }))
+	if err != nil {
+		panic(err)
+	}
+	err = telemetry.RegisterDriverSchema("multi", multiSchema)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (m *MultiDriver) Log(log telemetry.Log) error {
+	var errs []error
+	for _, child := range m.children {
+		if log.Level < child.logLevel {
+			continue
+		}
+		if err := child.driver.Log(log); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", child.name, err))
+		}
+	}
+	return multiError(errs)
+}
+
+func (m *MultiDriver) Flush() error {
+	var errs []error
+	for _, child := range m.children {
+		flusher, ok := child.driver.(telemetry.Flusher)
+		if !ok {
+			continue
+		}
+		if err := flusher.Flush(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", child.name, err))
+		}
+	}
+	return multiError(errs)
+}
+
+func multiError(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return &MultiError{Errs: errs}
+}
+
+func (m *MultiDriver) Close() error {
+	var errs []error
+	for _, child := range m.children {
+		if err := child.driver.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", child.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
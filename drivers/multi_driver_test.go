@@ -0,0 +1,157 @@
+package drivers
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/annwyl/telemetry/telemetry"
+)
+
+type recordingDriver struct {
+	logs   []telemetry.Log
+	err    error
+	closed bool
+}
+
+func (r *recordingDriver) Log(log telemetry.Log) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.logs = append(r.logs, log)
+	return nil
+}
+
+func (r *recordingDriver) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestMultiDriver(t *testing.T) {
+	broken := &recordingDriver{err: errors.New("backend down")}
+	all := &recordingDriver{}
+	errorsOnly := &recordingDriver{}
+
+	for name, driver := range map[string]*recordingDriver{"multiBroken": broken, "multiAll": all, "multiErrors": errorsOnly} {
+		driver := driver
+		err := telemetry.RegisterDriver(name, func(json.RawMessage) (telemetry.Driver, error) {
+			return driver, nil
+		})
+		if err != nil {
+			t.Fatalf("registerdriver gave error: %v", err)
+		}
+	}
+
+	driver, err := telemetry.NewDriver("multi", json.RawMessage(`{"drivers": [
+		{"driver": "multiBroken", "driver_config": ""},
+		{"driver": "multiAll", "driver_config": "", "log_level": 0},
+		{"driver": "multiErrors", "driver_config": "", "log_level": 3}
+	]}`))
+	if err != nil {
+		t.Fatalf("newdriver returned error: %v", err)
+	}
+
+	if err := driver.Log(telemetry.Log{Level: telemetry.InfoLevel, Message: "info"}); err == nil {
+		t.Error("wanted error from broken child")
+	}
+	driver.Log(telemetry.Log{Level: telemetry.ErrorLevel, Message: "error"})
+
+	if len(all.logs) != 2 {
+		t.Errorf("wanted broken child not to stop delivery, got %d logs", len(all.logs))
+	}
+	if len(errorsOnly.logs) != 1 || errorsOnly.logs[0].Message != "error" {
+		t.Errorf("wanted only the error entry, got %v", errorsOnly.logs)
+	}
+
+	if err := driver.Close(); err != nil {
+		t.Fatalf("close returned error: %v", err)
+	}
+	if !broken.closed || !all.closed || !errorsOnly.closed {
+		t.Error("wanted all children closed")
+	}
+}
+
+func TestMultiDriverUnknownChild(t *testing.T) {
+	_, err := telemetry.NewDriver("multi", json.RawMessage(`{"drivers": [{"driver": "missing"}]}`))
+	if err == nil {
+		t.Error("wanted error for unknown child driver")
+	}
+}
+
+// flakyDriver fails with a retryable error until failures runs out.
+type flakyDriver struct {
+	recordingDriver
+	failures int
+}
+
+type retryableError struct{}
+
+func (retryableError) Error() string   { return "backend busy" }
+func (retryableError) Retryable() bool { return true }
+
+func (f *flakyDriver) Log(log telemetry.Log) error {
+	if f.failures > 0 {
+		f.failures--
+		return retryableError{}
+	}
+	return f.recordingDriver.Log(log)
+}
+
+func TestMultiDriverChildRetry(t *testing.T) {
+	flaky := &flakyDriver{failures: 2}
+	healthy := &recordingDriver{}
+	broken := &recordingDriver{err: retryableError{}}
+	plain := &recordingDriver{}
+	deadLetter := &recordingDriver{}
+
+	drivers := map[string]telemetry.Driver{"retryFlaky": flaky, "retryHealthy": healthy, "retryBroken": broken, "retryPlain": plain, "retryDeadLetter": deadLetter}
+	for name, driver := range drivers {
+		driver := driver
+		err := telemetry.RegisterDriver(name, func(json.RawMessage) (telemetry.Driver, error) {
+			return driver, nil
+		})
+		if err != nil {
+			t.Fatalf("registerdriver gave error: %v", err)
+		}
+	}
+
+	driver, err := telemetry.NewRetryingDriver("multi", json.RawMessage(`{"drivers": [
+		{"driver": "retryFlaky", "driver_config": "", "retry": {"max_attempts": 3, "initial_backoff": "1ms"}},
+		{"driver": "retryHealthy", "driver_config": ""},
+		{"driver": "retryPlain", "driver_config": ""},
+		{"driver": "retryBroken", "driver_config": "", "retry": {"max_attempts": 2, "initial_backoff": "1ms", "dead_letter": {"driver": "retryDeadLetter", "driver_config": ""}}}
+	]}`), &telemetry.RetryConfig{MaxAttempts: 3, InitialBackoff: telemetry.JSONDuration(time.Millisecond)})
+	if err != nil {
+		t.Fatalf("newretryingdriver returned error: %v", err)
+	}
+
+	if err := driver.Log(telemetry.Log{Level: telemetry.InfoLevel, Message: "once"}); err != nil {
+		t.Errorf("wanted the failing children retried on their own, got %v", err)
+	}
+	if len(flaky.logs) != 1 || len(healthy.logs) != 1 || len(deadLetter.logs) != 1 {
+		t.Errorf("wanted one copy each, got flaky %d, healthy %d, dead letter %d", len(flaky.logs), len(healthy.logs), len(deadLetter.logs))
+	}
+
+	// a child without its own retry fails, the outer retry must not send
+	// the entry to every child again
+	plain.err = retryableError{}
+	err = driver.Log(telemetry.Log{Level: telemetry.InfoLevel, Message: "twice"})
+	var multiErr *MultiError
+	if !errors.As(err, &multiErr) || telemetry.IsRetryable(err) {
+		t.Errorf("wanted a multi error that isn't retryable, got %v", err)
+	}
+	if len(healthy.logs) != 2 {
+		t.Errorf("wanted no duplicates on the healthy child, got %d logs", len(healthy.logs))
+	}
+}
+
+func TestMultiDriverChildRetryConfig(t *testing.T) {
+	err := telemetry.ValidateDriverConfig("multi", json.RawMessage(`{"drivers": [
+		{"driver": "console", "driver_config": "", "retry": {"jitter": 2, "dead_letter": {"driver": "file", "driver_config": {}}}}
+	]}`)).Err()
+	want := "config validation failed: drivers[0].retry.jitter: retry jitter must be between 0 and 1; drivers[0].retry.dead_letter.driver_config.filename: filename required"
+	if err == nil || err.Error() != want {
+		t.Errorf("wanted %q, got %v", want, err)
+	}
+}
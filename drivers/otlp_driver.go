@@ -0,0 +1,428 @@
+package drivers
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/annwyl/telemetry/telemetry"
+)
+
+const (
+	defaultOTLPBatchSize = 512
+	defaultOTLPTimeout   = 10 * time.Second
+	otlpLogsPath         = "/v1/logs"
+	otlpScopeName        = "github.com/annwyl/telemetry"
+)
+
+type otlpConfig struct {
+	Endpoint           string                 `json:"endpoint" jsonschema:"required"`
+	Encoding           string                 `json:"encoding" jsonschema:"enum=protobuf|json"`
+	Headers            map[string]string      `json:"headers"`
+	ServiceName        string                 `json:"service_name"`
+	ResourceAttributes map[string]string      `json:"resource_attributes"`
+	BatchSize          int                    `json:"batch_size"`
+	FlushInterval      telemetry.JSONDuration `json:"flush_interval"`
+	Timeout            telemetry.JSONDuration `json:"timeout"`
+}
+
+// OTLPDriver exports logs to an OpenTelemetry collector over OTLP/HTTP.
+// Records are sent once batch_size are pending or flush_interval has
+// passed, encoded as protobuf unless encoding is "json".
+type OTLPDriver struct {
+	client   *http.Client
+	url      string
+	json     bool
+	headers  map[string]string
+	resource []otlpAttribute
+	batcher  *batcher
+}
+
+// otlpAttribute is a key with a string, int, double or bool value.
+type otlpAttribute struct {
+	key   string
+	value interface{}
+}
+
+func init() {
+	err := telemetry.RegisterDriver("otlp", func(config json.RawMessage) (telemetry.Driver, error) {
+		var cfg otlpConfig
+		if err := telemetry.DecodeStrict(config, &cfg); err != nil {
+			return nil, err
+		}
+		return newOTLPDriver(cfg)
+	})
+	if err != nil {
+		panic(err)
+	}
+	err = telemetry.RegisterDriverValidator("otlp", strictValidator(func() driverConfig { return &otlpConfig{} }))
+	if err != nil {
+		panic(err)
+	}
+	err = telemetry.RegisterDriverSchema("otlp", telemetry.SchemaFor(otlpConfig{}))
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (c otlpConfig) validate() error {
+	var errs telemetry.ConfigErrors
+	if c.Endpoint == "" {
+		errs.Add("endpoint", "otlp endpoint required")
+	}
+	switch c.Encoding {
+	case "", "protobuf", "json":
+	default:
+		errs.Add("encoding", "unknown otlp encoding %q", c.Encoding)
+	}
+	return errs.Err()
+}
+
+func newOTLPDriver(cfg otlpConfig) (*OTLPDriver, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	driver := &OTLPDriver{
+		url:     strings.TrimSuffix(cfg.Endpoint, "/"),
+		json:    cfg.Encoding == "json",
+		headers: cfg.Headers,
+	}
+	if !strings.HasSuffix(driver.url, otlpLogsPath) {
+		driver.url += otlpLogsPath
+	}
+
+	timeout := time.Duration(cfg.Timeout)
+	if timeout <= 0 {
+		timeout = defaultOTLPTimeout
+	}
+	driver.client = &http.Client{Timeout: timeout}
+
+	resource := make(map[string]interface{}, len(cfg.ResourceAttributes)+1)
+	for key, value := range cfg.ResourceAttributes {
+		resource[key] = value
+	}
+	if cfg.ServiceName != "" {
+		resource["service.name"] = cfg.ServiceName
+	}
+	driver.resource = otlpAttributes(resource)
+
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultOTLPBatchSize
+	}
+	interval := time.Duration(cfg.FlushInterval)
+	if interval <= 0 {
+		interval = defaultFlushInterval
+	}
+	driver.batcher = newBatcher(batchSize, 0, interval, driver.send)
+
+	return driver, nil
+}
+
+func (o *OTLPDriver) Log(log telemetry.Log) error {
+	return o.batcher.add(log, nil)
+}
+
+// Flush sends all pending records. Errors from earlier background flushes
+// that weren't reported yet are returned as well.
+func (o *OTLPDriver) Flush() error {
+	return o.batcher.Flush()
+}
+
+func (o *OTLPDriver) Close() error {
+	return o.batcher.close()
+}
+
+func (o *OTLPDriver) send(entries []batchEntry) error {
+	logs := logsOf(entries)
+
+	var body []byte
+	contentType := "application/x-protobuf"
+	if o.json {
+		var err error
+		if body, err = json.Marshal(o.jsonRequest(logs)); err != nil {
+			return err
+		}
+		contentType = "application/json"
+	} else {
+		body = o.protoRequest(logs)
+	}
+
+	req, err := http.NewRequest("POST", o.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for key, value := range o.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return &telemetry.UndeliveredError{Logs: logs, Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return &telemetry.UndeliveredError{Logs: logs, Err: &StatusError{Backend: "otlp", StatusCode: resp.StatusCode}}
+	}
+
+	// the response doesn't say which records were rejected, so the whole
+	// batch is handed back
+	response, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return &telemetry.UndeliveredError{Logs: logs, Err: fmt.Errorf("failed to read otlp response: %v", err)}
+	}
+	rejected, message, err := o.partialSuccess(response)
+	if err != nil {
+		return &telemetry.UndeliveredError{Logs: logs, Err: fmt.Errorf("failed to decode otlp response: %v", err)}
+	}
+	// the collector refused these for good, retrying won't help
+	if rejected > 0 {
+		return &telemetry.UndeliveredError{Logs: logs, Err: fmt.Errorf("otlp collector rejected %d of %d log records: %s", rejected, len(logs), message)}
+	}
+	return nil
+}
+
+// partialSuccess reads the rejected count from an ExportLogsServiceResponse.
+func (o *OTLPDriver) partialSuccess(response []byte) (int64, string, error) {
+	if len(bytes.TrimSpace(response)) == 0 {
+		return 0, "", nil
+	}
+
+	if o.json {
+		var result struct {
+			PartialSuccess struct {
+				RejectedLogRecords json.Number `json:"rejectedLogRecords"`
+				ErrorMessage       string      `json:"errorMessage"`
+			} `json:"partialSuccess"`
+		}
+		if err := json.Unmarshal(response, &result); err != nil {
+			return 0, "", err
+		}
+		if result.PartialSuccess.RejectedLogRecords == "" {
+			return 0, "", nil
+		}
+		rejected, err := result.PartialSuccess.RejectedLogRecords.Int64()
+		return rejected, result.PartialSuccess.ErrorMessage, err
+	}
+
+	fields, err := readProto(response)
+	if err != nil {
+		return 0, "", err
+	}
+	var rejected int64
+	var message string
+	for _, field := range fields {
+		if field.number != 1 || field.wire != wireBytes {
+			continue
+		}
+		partial, err := readProto(field.data)
+		if err != nil {
+			return 0, "", err
+		}
+		for _, p := range partial {
+			switch {
+			case p.number == 1 && p.wire == wireVarint:
+				rejected = int64(p.varint)
+			case p.number == 2 && p.wire == wireBytes:
+				message = string(p.data)
+			}
+		}
+	}
+	return rejected, message, nil
+}
+
+// otlpSeverity maps a level to the OpenTelemetry severity number and text.
+func otlpSeverity(level telemetry.LogLevel) (int, string) {
+	switch level {
+	case telemetry.TraceLevel:
+		return 1, "TRACE"
+	case telemetry.DebugLevel:
+		return 5, "DEBUG"
+	case telemetry.InfoLevel:
+		return 9, "INFO"
+	case telemetry.WarningLevel:
+		return 13, "WARN"
+	case telemetry.ErrorLevel:
+		return 17, "ERROR"
+	case telemetry.PanicLevel:
+		return 21, "PANIC"
+	case telemetry.FatalLevel:
+		return 24, "FATAL"
+	}
+	return 0, ""
+}
+
+// otlpTraceIDs returns the trace and span ID for a log. Transactions started
+// by the logger have 32 hex character IDs, so the transaction ID is used as
+// the trace ID when the log isn't part of a propagated trace.
+func otlpTraceIDs(log telemetry.Log) ([]byte, []byte) {
+	traceID := decodeID(log.TraceID, 16)
+	if traceID == nil {
+		traceID = decodeID(log.TransactionID, 16)
+	}
+	if traceID == nil {
+		return nil, nil
+	}
+	return traceID, decodeID(log.SpanID, 8)
+}
+
+func decodeID(id string, size int) []byte {
+	decoded, err := hex.DecodeString(id)
+	if err != nil || len(decoded) != size {
+		return nil
+	}
+	return decoded
+}
+
+// otlpAttributes sorts values by key so payloads are stable.
+func otlpAttributes(values map[string]interface{}) []otlpAttribute {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	attributes := make([]otlpAttribute, len(keys))
+	for i, key := range keys {
+		attributes[i] = otlpAttribute{key: key, value: otlpValue(values[key])}
+	}
+	return attributes
+}
+
+// otlpValue narrows a value to the scalar types attributes support, anything
+// else is sent as its JSON encoding.
+func otlpValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string, int64, float64, bool:
+		return v
+	case int:
+		return int64(v)
+	case nil:
+		return ""
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
+
+func (o *OTLPDriver) jsonRequest(logs []telemetry.Log) map[string]interface{} {
+	records := make([]map[string]interface{}, len(logs))
+	for i, log := range logs {
+		number, text := otlpSeverity(log.Level)
+		record := map[string]interface{}{
+			"timeUnixNano":         strconv.FormatInt(log.Timestamp.UnixNano(), 10),
+			"observedTimeUnixNano": strconv.FormatInt(time.Now().UnixNano(), 10),
+			"severityNumber":       number,
+			"severityText":         text,
+			"body":                 map[string]interface{}{"stringValue": log.Message},
+			"attributes":           jsonAttributes(otlpAttributes(log.Values())),
+		}
+		if traceID, spanID := otlpTraceIDs(log); traceID != nil {
+			record["traceId"] = hex.EncodeToString(traceID)
+			if spanID != nil {
+				record["spanId"] = hex.EncodeToString(spanID)
+			}
+		}
+		records[i] = record
+	}
+
+	return map[string]interface{}{
+		"resourceLogs": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{"attributes": jsonAttributes(o.resource)},
+			"scopeLogs": []interface{}{map[string]interface{}{
+				"scope":      map[string]interface{}{"name": otlpScopeName},
+				"logRecords": records,
+			}},
+		}},
+	}
+}
+
+func jsonAttributes(attributes []otlpAttribute) []map[string]interface{} {
+	encoded := make([]map[string]interface{}, len(attributes))
+	for i, attribute := range attributes {
+		var value map[string]interface{}
+		switch v := attribute.value.(type) {
+		case int64:
+			// 64 bit integers are strings in the protobuf JSON mapping
+			value = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]interface{}{"doubleValue": v}
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		default:
+			value = map[string]interface{}{"stringValue": v}
+		}
+		encoded[i] = map[string]interface{}{"key": attribute.key, "value": value}
+	}
+	return encoded
+}
+
+// protoRequest encodes an ExportLogsServiceRequest.
+func (o *OTLPDriver) protoRequest(logs []telemetry.Log) []byte {
+	observed := uint64(time.Now().UnixNano())
+
+	var request protoBuffer
+	request.messageField(1, func(resourceLogs *protoBuffer) {
+		resourceLogs.messageField(1, func(resource *protoBuffer) {
+			protoAttributes(resource, 1, o.resource)
+		})
+		resourceLogs.messageField(2, func(scopeLogs *protoBuffer) {
+			scopeLogs.messageField(1, func(scope *protoBuffer) {
+				scope.stringField(1, otlpScopeName)
+			})
+			for _, log := range logs {
+				scopeLogs.messageField(2, func(record *protoBuffer) {
+					number, text := otlpSeverity(log.Level)
+					record.fixed64Field(1, uint64(log.Timestamp.UnixNano()))
+					record.uvarintField(2, uint64(number))
+					record.stringField(3, text)
+					record.messageField(5, func(body *protoBuffer) {
+						body.stringField(1, log.Message)
+					})
+					protoAttributes(record, 6, otlpAttributes(log.Values()))
+					traceID, spanID := otlpTraceIDs(log)
+					record.bytesField(9, traceID)
+					record.bytesField(10, spanID)
+					record.fixed64Field(11, observed)
+				})
+			}
+		})
+	})
+	return request
+}
+
+func protoAttributes(message *protoBuffer, field int, attributes []otlpAttribute) {
+	for _, attribute := range attributes {
+		message.messageField(field, func(keyValue *protoBuffer) {
+			keyValue.stringField(1, attribute.key)
+			keyValue.messageField(2, func(value *protoBuffer) {
+				switch v := attribute.value.(type) {
+				case int64:
+					value.oneofVarint(3, uint64(v))
+				case float64:
+					value.doubleField(4, v)
+				case bool:
+					var b uint64
+					if v {
+						b = 1
+					}
+					value.oneofVarint(2, b)
+				default:
+					value.oneofString(1, v.(string))
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,334 @@
+package drivers
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/annwyl/telemetry/telemetry"
+)
+
+type otlpReceiver struct {
+	mu       sync.Mutex
+	bodies   [][]byte
+	types    []string
+	status   int
+	response string
+}
+
+func (o *otlpReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/logs" {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	o.mu.Lock()
+	o.bodies = append(o.bodies, body)
+	o.types = append(o.types, r.Header.Get("Content-Type"))
+	response := o.response
+	o.mu.Unlock()
+
+	if o.status != 0 {
+		w.WriteHeader(o.status)
+	}
+	w.Write([]byte(response))
+}
+
+func newOTLPTestDriver(t *testing.T, receiver *otlpReceiver, encoding string) *OTLPDriver {
+	server := httptest.NewServer(receiver)
+	t.Cleanup(server.Close)
+
+	driver, err := newOTLPDriver(otlpConfig{
+		Endpoint:           server.URL,
+		Encoding:           encoding,
+		ServiceName:        "checkout",
+		ResourceAttributes: map[string]string{"deployment.environment": "test"},
+		BatchSize:          2,
+		FlushInterval:      telemetry.JSONDuration(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("newOTLPDriver returned error: %v", err)
+	}
+	t.Cleanup(func() { driver.Close() })
+	return driver
+}
+
+var otlpTestLog = telemetry.Log{
+	Timestamp:     time.Unix(1700000000, 5),
+	Level:         telemetry.WarningLevel,
+	Message:       "slow query",
+	Tags:          map[string]string{"db": "orders"},
+	Fields:        telemetry.Fields{telemetry.Int("rows", 42), telemetry.Bool("cached", false), telemetry.Duration("took", 1500*time.Millisecond)},
+	TransactionID: "4bf92f3577b34da6a3ce929d0e0e4736",
+	TraceID:       "4bf92f3577b34da6a3ce929d0e0e4736",
+	SpanID:        "00f067aa0ba902b7",
+}
+
+func TestOTLPJSON(t *testing.T) {
+	receiver := &otlpReceiver{}
+	driver := newOTLPTestDriver(t, receiver, "json")
+
+	if err := driver.Log(otlpTestLog); err != nil {
+		t.Fatalf("log returned error: %v", err)
+	}
+	if len(receiver.bodies) != 0 {
+		t.Fatal("wanted records held until the batch is full")
+	}
+	if err := driver.Log(telemetry.Log{Level: telemetry.DebugLevel, Message: "second"}); err != nil {
+		t.Fatalf("log returned error: %v", err)
+	}
+	if len(receiver.bodies) != 1 || receiver.types[0] != "application/json" {
+		t.Fatalf("wanted one json request, got %d %v", len(receiver.bodies), receiver.types)
+	}
+
+	var request struct {
+		ResourceLogs []struct {
+			Resource struct {
+				Attributes []struct {
+					Key   string                 `json:"key"`
+					Value map[string]interface{} `json:"value"`
+				} `json:"attributes"`
+			} `json:"resource"`
+			ScopeLogs []struct {
+				LogRecords []struct {
+					TimeUnixNano   string            `json:"timeUnixNano"`
+					SeverityNumber int               `json:"severityNumber"`
+					SeverityText   string            `json:"severityText"`
+					Body           map[string]string `json:"body"`
+					TraceID        string            `json:"traceId"`
+					SpanID         string            `json:"spanId"`
+					Attributes     []struct {
+						Key   string                 `json:"key"`
+						Value map[string]interface{} `json:"value"`
+					} `json:"attributes"`
+				} `json:"logRecords"`
+			} `json:"scopeLogs"`
+		} `json:"resourceLogs"`
+	}
+	if err := json.Unmarshal(receiver.bodies[0], &request); err != nil {
+		t.Fatalf("invalid json payload: %v", err)
+	}
+
+	resource := request.ResourceLogs[0].Resource.Attributes
+	if len(resource) != 2 || resource[1].Key != "service.name" || resource[1].Value["stringValue"] != "checkout" {
+		t.Errorf("unexpected resource attributes %+v", resource)
+	}
+
+	records := request.ResourceLogs[0].ScopeLogs[0].LogRecords
+	if len(records) != 2 {
+		t.Fatalf("wanted 2 records, got %d", len(records))
+	}
+	record := records[0]
+	if record.TimeUnixNano != "1700000000000000005" || record.SeverityNumber != 13 || record.SeverityText != "WARN" || record.Body["stringValue"] != "slow query" {
+		t.Errorf("unexpected record %+v", record)
+	}
+	if record.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || record.SpanID != "00f067aa0ba902b7" {
+		t.Errorf("unexpected trace context %s %s", record.TraceID, record.SpanID)
+	}
+
+	attributes := map[string]map[string]interface{}{}
+	for _, attribute := range record.Attributes {
+		attributes[attribute.Key] = attribute.Value
+	}
+	if attributes["db"]["stringValue"] != "orders" || attributes["rows"]["intValue"] != "42" || attributes["cached"]["boolValue"] != false || attributes["took"]["doubleValue"] != 1500.0 {
+		t.Errorf("unexpected attributes %v", attributes)
+	}
+
+	if records[1].SeverityNumber != 5 || records[1].TraceID != "" {
+		t.Errorf("unexpected second record %+v", records[1])
+	}
+}
+
+func TestOTLPProtobuf(t *testing.T) {
+	receiver := &otlpReceiver{}
+	driver := newOTLPTestDriver(t, receiver, "")
+
+	if err := driver.Log(otlpTestLog); err != nil {
+		t.Fatalf("log returned error: %v", err)
+	}
+	if err := driver.Flush(); err != nil {
+		t.Fatalf("flush returned error: %v", err)
+	}
+	if len(receiver.bodies) != 1 || receiver.types[0] != "application/x-protobuf" {
+		t.Fatalf("wanted one protobuf request, got %d %v", len(receiver.bodies), receiver.types)
+	}
+
+	// ExportLogsServiceRequest > ResourceLogs > ScopeLogs > LogRecord
+	resourceLogs := protoMessage(t, receiver.bodies[0], 1)
+	scopeLogs := protoMessage(t, resourceLogs, 2)
+	record := protoMessage(t, scopeLogs, 2)
+
+	fields, err := readProto(record)
+	if err != nil {
+		t.Fatalf("invalid log record: %v", err)
+	}
+	attributes := map[string][]byte{}
+	for _, field := range fields {
+		switch field.number {
+		case 1:
+			if field.varint != uint64(otlpTestLog.Timestamp.UnixNano()) {
+				t.Errorf("unexpected time %d", field.varint)
+			}
+		case 2:
+			if field.varint != 13 {
+				t.Errorf("unexpected severity %d", field.varint)
+			}
+		case 3:
+			if string(field.data) != "WARN" {
+				t.Errorf("unexpected severity text %s", field.data)
+			}
+		case 5:
+			if string(protoMessage(t, field.data, 1)) != "slow query" {
+				t.Errorf("unexpected body %q", field.data)
+			}
+		case 6:
+			attributes[string(protoMessage(t, field.data, 1))] = protoMessage(t, field.data, 2)
+		case 9:
+			if len(field.data) != 16 || field.data[0] != 0x4b {
+				t.Errorf("unexpected trace id %x", field.data)
+			}
+		case 10:
+			if len(field.data) != 8 || field.data[7] != 0xb7 {
+				t.Errorf("unexpected span id %x", field.data)
+			}
+		}
+	}
+
+	if string(protoMessage(t, attributes["db"], 1)) != "orders" {
+		t.Errorf("unexpected db attribute %q", attributes["db"])
+	}
+	if rows, _ := readProto(attributes["rows"]); len(rows) != 1 || rows[0].number != 3 || rows[0].varint != 42 {
+		t.Errorf("unexpected rows attribute %+v", rows)
+	}
+	if cached, _ := readProto(attributes["cached"]); len(cached) != 1 || cached[0].number != 2 || cached[0].varint != 0 {
+		t.Errorf("wanted false bool attribute, got %+v", cached)
+	}
+	if took := attributes["took"]; len(took) != 9 || binary.LittleEndian.Uint64(took[1:]) == 0 {
+		t.Errorf("unexpected took attribute %x", took)
+	}
+}
+
+// protoMessage returns the first length delimited field with the number.
+func protoMessage(t *testing.T, data []byte, number int) []byte {
+	t.Helper()
+	fields, err := readProto(data)
+	if err != nil {
+		t.Fatalf("invalid protobuf: %v", err)
+	}
+	for _, field := range fields {
+		if field.number == number && field.wire == wireBytes {
+			return field.data
+		}
+	}
+	t.Fatalf("field %d missing", number)
+	return nil
+}
+
+func TestOTLPStatusError(t *testing.T) {
+	receiver := &otlpReceiver{status: http.StatusServiceUnavailable}
+	driver := newOTLPTestDriver(t, receiver, "json")
+
+	driver.Log(otlpTestLog)
+	err := driver.Flush()
+
+	var undelivered *telemetry.UndeliveredError
+	if !errors.As(err, &undelivered) || len(undelivered.Logs) != 1 {
+		t.Fatalf("wanted undelivered log, got %v", err)
+	}
+	if !telemetry.IsRetryable(undelivered.Err) {
+		t.Errorf("wanted 503 to be retryable, got %v", undelivered.Err)
+	}
+}
+
+func TestOTLPPartialSuccess(t *testing.T) {
+	receiver := &otlpReceiver{response: `{"partialSuccess":{"rejectedLogRecords":"1","errorMessage":"too old"}}`}
+	driver := newOTLPTestDriver(t, receiver, "json")
+
+	driver.Log(otlpTestLog)
+	err := driver.Flush()
+	var undelivered *telemetry.UndeliveredError
+	if !errors.As(err, &undelivered) || len(undelivered.Logs) != 1 {
+		t.Fatalf("wanted the batch handed back, got %v", err)
+	}
+	if telemetry.IsRetryable(err) {
+		t.Error("rejected records shouldn't be retried")
+	}
+}
+
+func TestOTLPRetryBackgroundRejection(t *testing.T) {
+	receiver := &otlpReceiver{response: `{"partialSuccess":{"rejectedLogRecords":"1","errorMessage":"too old"}}`}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	driver, err := newOTLPDriver(otlpConfig{
+		Endpoint:      server.URL,
+		Encoding:      "json",
+		FlushInterval: telemetry.JSONDuration(10 * time.Millisecond),
+	})
+	if err != nil {
+		t.Fatalf("newOTLPDriver returned error: %v", err)
+	}
+	deadLetter := &recordingDriver{}
+	retry := telemetry.NewRetryDriver(driver, telemetry.RetryConfig{InitialBackoff: telemetry.JSONDuration(time.Millisecond)}, deadLetter, nil)
+
+	retry.Log(telemetry.Log{Message: "rejected"})
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		driver.batcher.mutex.Lock()
+		failed := driver.batcher.err != nil
+		driver.batcher.mutex.Unlock()
+		if failed {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	receiver.mu.Lock()
+	receiver.response = ""
+	receiver.mu.Unlock()
+
+	if err := retry.Log(telemetry.Log{Message: "buffered"}); err != nil {
+		t.Fatalf("wanted nil error once dead lettered, got %v", err)
+	}
+	if len(deadLetter.logs) != 1 || deadLetter.logs[0].Message != "rejected" {
+		t.Errorf("wanted only the rejected record dead lettered, got %v", deadLetter.logs)
+	}
+	if err := retry.Close(); err != nil {
+		t.Fatalf("close returned error: %v", err)
+	}
+
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	var sent int
+	for _, body := range receiver.bodies {
+		sent += strings.Count(string(body), `"buffered"`)
+	}
+	if sent != 1 {
+		t.Errorf("wanted the buffered record sent once, got %d", sent)
+	}
+}
+
+func TestOTLPConfig(t *testing.T) {
+	if _, err := newOTLPDriver(otlpConfig{}); err == nil {
+		t.Error("wanted error without endpoint")
+	}
+	if _, err := newOTLPDriver(otlpConfig{Endpoint: "http://localhost:4318", Encoding: "xml"}); err == nil {
+		t.Error("wanted error for unknown encoding")
+	}
+
+	driver, err := newOTLPDriver(otlpConfig{Endpoint: "http://localhost:4318/v1/logs/"})
+	if err != nil {
+		t.Fatalf("newOTLPDriver returned error: %v", err)
+	}
+	defer driver.Close()
+	if driver.url != "http://localhost:4318/v1/logs" {
+		t.Errorf("unexpected url %s", driver.url)
+	}
+}
@@ -0,0 +1,141 @@
+package drivers
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// protoBuffer is just enough of a protobuf encoder for the OTLP logs
+// messages, the schema lives in the otlp driver.
+type protoBuffer []byte
+
+func (p *protoBuffer) tag(field, wire int) {
+	p.varint(uint64(field)<<3 | uint64(wire))
+}
+
+func (p *protoBuffer) varint(v uint64) {
+	*p = binary.AppendUvarint(*p, v)
+}
+
+func (p *protoBuffer) uvarintField(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	p.tag(field, wireVarint)
+	p.varint(v)
+}
+
+func (p *protoBuffer) fixed64Field(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	p.tag(field, wireFixed64)
+	*p = binary.LittleEndian.AppendUint64(*p, v)
+}
+
+func (p *protoBuffer) doubleField(field int, v float64) {
+	p.tag(field, wireFixed64)
+	*p = binary.LittleEndian.AppendUint64(*p, math.Float64bits(v))
+}
+
+func (p *protoBuffer) bytesField(field int, v []byte) {
+	if len(v) == 0 {
+		return
+	}
+	p.tag(field, wireBytes)
+	p.varint(uint64(len(v)))
+	*p = append(*p, v...)
+}
+
+func (p *protoBuffer) stringField(field int, v string) {
+	if v == "" {
+		return
+	}
+	p.tag(field, wireBytes)
+	p.varint(uint64(len(v)))
+	*p = append(*p, v...)
+}
+
+// oneofVarint and oneofString write members of a oneof, which have to be
+// present even when they hold the zero value.
+func (p *protoBuffer) oneofVarint(field int, v uint64) {
+	p.tag(field, wireVarint)
+	p.varint(v)
+}
+
+func (p *protoBuffer) oneofString(field int, v string) {
+	p.tag(field, wireBytes)
+	p.varint(uint64(len(v)))
+	*p = append(*p, v...)
+}
+
+// messageField writes an embedded message, encode fills in its fields.
+func (p *protoBuffer) messageField(field int, encode func(*protoBuffer)) {
+	var message protoBuffer
+	encode(&message)
+	p.tag(field, wireBytes)
+	p.varint(uint64(len(message)))
+	*p = append(*p, message...)
+}
+
+// protoField is one field read back by readProto.
+type protoField struct {
+	number int
+	wire   int
+	varint uint64
+	data   []byte
+}
+
+// readProto splits a message into its fields, used for collector responses.
+func readProto(data []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, fmt.Errorf("invalid protobuf field key")
+		}
+		data = data[n:]
+
+		field := protoField{number: int(key >> 3), wire: int(key & 7)}
+		switch field.wire {
+		case wireVarint:
+			field.varint, n = binary.Uvarint(data)
+			if n <= 0 {
+				return nil, fmt.Errorf("invalid protobuf varint")
+			}
+			data = data[n:]
+		case wireFixed64:
+			if len(data) < 8 {
+				return nil, fmt.Errorf("truncated protobuf fixed64")
+			}
+			field.varint = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case wireFixed32:
+			if len(data) < 4 {
+				return nil, fmt.Errorf("truncated protobuf fixed32")
+			}
+			field.varint = uint64(binary.LittleEndian.Uint32(data))
+			data = data[4:]
+		case wireBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return nil, fmt.Errorf("truncated protobuf bytes")
+			}
+			field.data = data[n : n+int(length)]
+			data = data[n+int(length):]
+		default:
+			return nil, fmt.Errorf("unsupported protobuf wire type %d", field.wire)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
@@ -0,0 +1,221 @@
+package drivers
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/annwyl/telemetry/telemetry"
+)
+
+const (
+	defaultPrettyTimeFormat    = "15:04:05.000"
+	defaultPrettyLayout        = "time level transaction message tags"
+	defaultTransactionIDLength = 8
+	prettyMessageWidth         = 40
+)
+
+const (
+	colorReset  = "\x1b[0m"
+	colorFaint  = "\x1b[2m"
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorCyan   = "\x1b[36m"
+	colorGray   = "\x1b[90m"
+)
+
+// prettyFormatter writes aligned, optionally colored lines for reading in a
+// terminal. The layout is the list of columns to write, in order.
+type prettyFormatter struct {
+	layout              []string
+	timeFormat          string
+	transactionIDLength int
+	color               bool
+}
+
+func newPrettyFormatter(layout, timeFormat string, transactionIDLength int, color bool) (*prettyFormatter, error) {
+	if layout == "" {
+		layout = defaultPrettyLayout
+	}
+	columns := strings.Fields(layout)
+	for _, column := range columns {
+		switch column {
+		case "time", "level", "transaction", "message", "tags":
+		default:
+			return nil, fmt.Errorf("unknown console layout column %q (must be time, level, transaction, message or tags)", column)
+		}
+	}
+
+	if timeFormat == "" {
+		timeFormat = defaultPrettyTimeFormat
+	}
+	if transactionIDLength == 0 {
+		transactionIDLength = defaultTransactionIDLength
+	}
+
+	return &prettyFormatter{
+		layout:              columns,
+		timeFormat:          timeFormat,
+		transactionIDLength: transactionIDLength,
+		color:               color,
+	}, nil
+}
+
+func (p *prettyFormatter) Format(log telemetry.Log) ([]byte, error) {
+	var b bytes.Buffer
+	values := log.StringValues()
+
+	for i, column := range p.layout {
+		var text, color string
+		switch column {
+		case "time":
+			text, color = log.Timestamp.Format(p.timeFormat), colorFaint
+		case "level":
+			text, color = prettyLevel(log.Level)
+		case "transaction":
+			if log.TransactionID != "" {
+				text, color = "["+p.shortID(log.TransactionID)+"]", colorFaint
+			} else if p.transactionIDLength >= 0 {
+				// keep the columns that follow in line with entries that
+				// have a transaction
+				text = strings.Repeat(" ", p.transactionIDLength+2)
+			} else {
+				continue
+			}
+		case "message":
+			text = log.Message
+			// line up the tags that follow
+			if len(values) > 0 && i < len(p.layout)-1 && len(text) < prettyMessageWidth {
+				text += strings.Repeat(" ", prettyMessageWidth-len(text))
+			}
+		case "tags":
+			if len(values) == 0 {
+				continue
+			}
+			if b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			p.writeTags(&b, values)
+			continue
+		}
+
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		p.write(&b, text, color)
+	}
+
+	line := bytes.TrimRight(b.Bytes(), " ")
+	return append(line, '\n'), nil
+}
+
+// shortID cuts the transaction ID to its first characters, a negative
+// length keeps all of it.
+func (p *prettyFormatter) shortID(id string) string {
+	if p.transactionIDLength < 0 || len(id) <= p.transactionIDLength {
+		return id
+	}
+	return id[:p.transactionIDLength]
+}
+
+func (p *prettyFormatter) writeTags(b *bytes.Buffer, values map[string]string) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for i, key := range keys {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		p.write(b, key+"=", colorCyan)
+		value := values[key]
+		if prettyNeedsQuoting(value) {
+			value = strconv.Quote(value)
+		}
+		b.WriteString(value)
+	}
+}
+
+func (p *prettyFormatter) write(b *bytes.Buffer, text, color string) {
+	if !p.color || color == "" {
+		b.WriteString(text)
+		return
+	}
+	b.WriteString(color)
+	b.WriteString(text)
+	b.WriteString(colorReset)
+}
+
+// prettyLevel is the level name padded to the same width, with its color.
+func prettyLevel(level telemetry.LogLevel) (string, string) {
+	switch level {
+	case telemetry.TraceLevel:
+		return "TRACE", colorGray
+	case telemetry.DebugLevel:
+		return "DEBUG", colorGray
+	case telemetry.InfoLevel:
+		return "INFO ", colorGreen
+	case telemetry.WarningLevel:
+		return "WARN ", colorYellow
+	case telemetry.ErrorLevel:
+		return "ERROR", colorRed
+	case telemetry.PanicLevel:
+		return "PANIC", colorRed
+	case telemetry.FatalLevel:
+		return "FATAL", colorRed
+	}
+	return fmt.Sprintf("%-5d", level), ""
+}
+
+func prettyNeedsQuoting(value string) bool {
+	if value == "" {
+		return true
+	}
+	for _, r := range value {
+		if r == '"' || unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// useColor decides whether to write colors to file. "always" and "never"
+// are final, otherwise FORCE_COLOR turns colors on, NO_COLOR or a dumb
+// terminal turn them off, and in the end it depends on file being a TTY.
+func useColor(mode string, file *os.File, getenv func(string) string) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "", "auto":
+	default:
+		return false, fmt.Errorf("invalid console color %q (must be auto, always or never)", mode)
+	}
+
+	if force := getenv("FORCE_COLOR"); force != "" {
+		return force != "0" && force != "false", nil
+	}
+	if getenv("NO_COLOR") != "" || getenv("TERM") == "dumb" {
+		return false, nil
+	}
+	return isTerminal(file), nil
+}
+
+func isTerminal(file *os.File) bool {
+	if file == nil {
+		return false
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
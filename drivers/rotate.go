@@ -0,0 +1,320 @@
+package drivers
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/annwyl/telemetry/telemetry"
+)
+
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// rename is replaced in tests of failed rotations.
+var rename = os.Rename
+
+// fileConfig is the driver_config of the file and json drivers. It can also
+// be given as a plain filename string, which turns rotation off.
+type fileConfig struct {
+	telemetry.FormatConfig
+	Filename   string                 `json:"filename" jsonschema:"required"`
+	MaxSize    int64                  `json:"max_size"`
+	Interval   string                 `json:"interval" jsonschema:"enum=hourly|daily"`
+	MaxBackups int                    `json:"max_backups"`
+	MaxAge     telemetry.JSONDuration `json:"max_age"`
+	Compress   bool                   `json:"compress"`
+}
+
+func (c *fileConfig) UnmarshalJSON(data []byte) error {
+	var filename string
+	if err := json.Unmarshal(data, &filename); err == nil {
+		*c = fileConfig{Filename: filename}
+		return nil
+	}
+
+	type plain fileConfig
+	return json.Unmarshal(data, (*plain)(c))
+}
+
+func (c fileConfig) validate() error {
+	var errs telemetry.ConfigErrors
+	if c.Filename == "" {
+		errs.Add("filename", "filename required")
+	}
+	switch c.Interval {
+	case "", "hourly", "daily":
+	default:
+		errs.Add("interval", "invalid rotation interval: %s (must be hourly or daily)", c.Interval)
+	}
+	if c.MaxSize < 0 {
+		errs.Add("max_size", "max_size can't be negative")
+	}
+	if c.MaxBackups < 0 {
+		errs.Add("max_backups", "max_backups can't be negative")
+	}
+	if c.MaxAge < 0 {
+		errs.Add("max_age", "max_age can't be negative")
+	}
+	if _, err := telemetry.NewFormatter(c.FormatConfig, "text"); err != nil {
+		errs.Add("format", "%v", err)
+	}
+	return errs.Err()
+}
+
+// rotatingFile is an io.WriteCloser that moves the file aside to a
+// timestamped name once it reaches max_size or the interval has passed.
+// Rotated files are compressed and cleaned up in the background.
+type rotatingFile struct {
+	mutex  sync.Mutex
+	config fileConfig
+	file   *os.File
+	size   int64
+	period time.Time
+	now    func() time.Time
+
+	mill sync.Mutex
+	wg   sync.WaitGroup
+	err  error
+}
+
+func openRotatingFile(config fileConfig) (*rotatingFile, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	r := &rotatingFile{config: config, now: time.Now}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	file, err := os.OpenFile(r.config.Filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	r.file = file
+	r.size = info.Size()
+	r.period = r.periodOf(r.now())
+	if r.size > 0 {
+		r.period = r.periodOf(info.ModTime())
+	}
+	return nil
+}
+
+func (r *rotatingFile) periodOf(t time.Time) time.Time {
+	switch r.config.Interval {
+	case "hourly":
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	case "daily":
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	}
+	return time.Time{}
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// a failed rotation may have left the file closed
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return 0, fmt.Errorf("failed to reopen %s: %v", r.config.Filename, err)
+		}
+	}
+
+	if r.size > 0 && r.shouldRotate(len(p)) {
+		if err := r.rotate(); err != nil {
+			return 0, fmt.Errorf("failed to rotate %s: %v", r.config.Filename, err)
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) shouldRotate(next int) bool {
+	if r.config.MaxSize > 0 && r.size+int64(next) > r.config.MaxSize {
+		return true
+	}
+	return r.config.Interval != "" && !r.periodOf(r.now()).Equal(r.period)
+}
+
+// rotate leaves r.file open on the original file when the rename fails, so
+// rotation is tried again on the next write, and nil when opening the new
+// file fails, so Write opens it again.
+func (r *rotatingFile) rotate() error {
+	err := r.file.Close()
+	r.file = nil
+	if err != nil {
+		return err
+	}
+
+	// two rotations in the same millisecond would otherwise overwrite each other
+	stamp := r.now()
+	backup := r.backupName(stamp)
+	for exists(backup) || exists(backup+".gz") {
+		stamp = stamp.Add(time.Millisecond)
+		backup = r.backupName(stamp)
+	}
+	if err := rename(r.config.Filename, backup); err != nil {
+		return errors.Join(err, r.open())
+	}
+
+	if err := r.open(); err != nil {
+		return err
+	}
+	r.period = r.periodOf(r.now())
+
+	r.wg.Add(1)
+	go r.cleanUp(backup)
+	return nil
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func (r *rotatingFile) backupName(t time.Time) string {
+	ext := filepath.Ext(r.config.Filename)
+	base := strings.TrimSuffix(r.config.Filename, ext)
+	return fmt.Sprintf("%s-%s%s", base, t.UTC().Format(backupTimeFormat), ext)
+}
+
+// cleanUp compresses the freshly rotated file and removes backups that are
+// past max_backups or max_age.
+func (r *rotatingFile) cleanUp(backup string) {
+	defer r.wg.Done()
+
+	r.mill.Lock()
+	defer r.mill.Unlock()
+
+	var errs []error
+	if r.config.Compress {
+		errs = append(errs, compressFile(backup))
+	}
+	errs = append(errs, r.removeOld())
+
+	if err := errors.Join(errs...); err != nil {
+		r.mutex.Lock()
+		r.err = errors.Join(r.err, err)
+		r.mutex.Unlock()
+	}
+}
+
+type backupFile struct {
+	path      string
+	timestamp time.Time
+}
+
+func (r *rotatingFile) backups() ([]backupFile, error) {
+	dir := filepath.Dir(r.config.Filename)
+	ext := filepath.Ext(r.config.Filename)
+	prefix := strings.TrimSuffix(filepath.Base(r.config.Filename), ext) + "-"
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []backupFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := strings.TrimPrefix(name, prefix)
+		stamp = strings.TrimSuffix(stamp, ".gz")
+		if !strings.HasSuffix(stamp, ext) {
+			continue
+		}
+		timestamp, err := time.Parse(backupTimeFormat, strings.TrimSuffix(stamp, ext))
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backupFile{path: filepath.Join(dir, name), timestamp: timestamp})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].timestamp.After(backups[j].timestamp)
+	})
+	return backups, nil
+}
+
+func (r *rotatingFile) removeOld() error {
+	if r.config.MaxBackups == 0 && r.config.MaxAge == 0 {
+		return nil
+	}
+
+	backups, err := r.backups()
+	if err != nil {
+		return err
+	}
+
+	cutoff := r.now().Add(-time.Duration(r.config.MaxAge))
+	var errs []error
+	for i, backup := range backups {
+		tooMany := r.config.MaxBackups > 0 && i >= r.config.MaxBackups
+		tooOld := r.config.MaxAge > 0 && backup.timestamp.Before(cutoff)
+		if tooMany || tooOld {
+			errs = append(errs, os.Remove(backup.path))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := errors.Join(gz.Close(), dst.Close()); err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	return os.Remove(path)
+}
+
+// Close waits for background compression and returns its errors along with
+// the error from closing the file.
+func (r *rotatingFile) Close() error {
+	r.wg.Wait()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.file == nil {
+		return r.err
+	}
+	return errors.Join(r.file.Close(), r.err)
+}
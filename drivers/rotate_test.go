@@ -0,0 +1,188 @@
+package drivers
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/annwyl/telemetry/telemetry"
+)
+
+func TestFileConfigForms(t *testing.T) {
+	var cfg fileConfig
+	if err := json.Unmarshal([]byte(`"logs.txt"`), &cfg); err != nil {
+		t.Fatalf("unmarshal of string form returned error: %v", err)
+	}
+	if cfg.Filename != "logs.txt" {
+		t.Errorf("wanted filename logs.txt, got %s", cfg.Filename)
+	}
+
+	err := json.Unmarshal([]byte(`{"filename": "logs.txt", "max_size": 1024, "interval": "daily", "max_age": "72h", "compress": true}`), &cfg)
+	if err != nil {
+		t.Fatalf("unmarshal of object form returned error: %v", err)
+	}
+	if cfg.MaxSize != 1024 || cfg.Interval != "daily" || time.Duration(cfg.MaxAge) != 72*time.Hour || !cfg.Compress {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+
+	cfg.Interval = "weekly"
+	if err := cfg.validate(); err == nil {
+		t.Error("wanted error for invalid interval")
+	}
+}
+
+func rotatedFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.Name() != "app.log" {
+			names = append(names, entry.Name())
+		}
+	}
+	return names
+}
+
+func TestRotateBySize(t *testing.T) {
+	dir := t.TempDir()
+	file, err := openRotatingFile(fileConfig{Filename: filepath.Join(dir, "app.log"), MaxSize: 10, MaxBackups: 2})
+	if err != nil {
+		t.Fatalf("openRotatingFile returned error: %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		if _, err := file.Write([]byte("0123456789")); err != nil {
+			t.Fatalf("write returned error: %v", err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		t.Fatalf("close returned error: %v", err)
+	}
+
+	backups := rotatedFiles(t, dir)
+	if len(backups) != 2 {
+		t.Fatalf("wanted 2 backups kept, got %v", backups)
+	}
+	for _, name := range backups {
+		if !strings.HasPrefix(name, "app-") || !strings.HasSuffix(name, ".log") {
+			t.Errorf("unexpected backup name %s", name)
+		}
+	}
+}
+
+func TestRotateRenameFails(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	file, err := openRotatingFile(fileConfig{Filename: filename, MaxSize: 10})
+	if err != nil {
+		t.Fatalf("openRotatingFile returned error: %v", err)
+	}
+
+	rename = func(string, string) error { return errors.New("cross-device link") }
+	defer func() { rename = os.Rename }()
+
+	if _, err := file.Write([]byte("0123456789")); err != nil {
+		t.Fatalf("write returned error: %v", err)
+	}
+	if _, err := file.Write([]byte("abcdefghij")); err == nil || !strings.Contains(err.Error(), "cross-device link") {
+		t.Fatalf("wanted the rename error, got %v", err)
+	}
+
+	rename = os.Rename
+	if _, err := file.Write([]byte("abcdefghij")); err != nil {
+		t.Fatalf("wanted writes to work again after a failed rotation, got %v", err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatalf("close returned error: %v", err)
+	}
+
+	if backups := rotatedFiles(t, dir); len(backups) != 1 {
+		t.Errorf("wanted the retried rotation to leave a backup, got %v", backups)
+	}
+	if data, _ := os.ReadFile(filename); string(data) != "abcdefghij" {
+		t.Errorf("wanted the new entry in a fresh file, got %q", data)
+	}
+}
+
+func TestRotateByInterval(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+
+	file, err := openRotatingFile(fileConfig{Filename: filepath.Join(dir, "app.log"), Interval: "hourly", Compress: true})
+	if err != nil {
+		t.Fatalf("openRotatingFile returned error: %v", err)
+	}
+	file.now = func() time.Time { return now }
+	file.period = file.periodOf(now)
+
+	file.Write([]byte("first\n"))
+	file.Write([]byte("same hour\n"))
+	if backups := rotatedFiles(t, dir); len(backups) != 0 {
+		t.Fatalf("wanted no rotation within the hour, got %v", backups)
+	}
+
+	now = now.Add(time.Hour)
+	file.Write([]byte("next hour\n"))
+	file.Close()
+
+	backups := rotatedFiles(t, dir)
+	if len(backups) != 1 || backups[0] != "app-2024-05-01T11-30-00.000.log.gz" {
+		t.Fatalf("wanted one compressed backup, got %v", backups)
+	}
+
+	current, err := os.ReadFile(filepath.Join(dir, "app.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(current) != "next hour\n" {
+		t.Errorf("wanted only the new entry in the current file, got %q", current)
+	}
+}
+
+func TestRotateMaxAge(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, "app-2000-01-01T00-00-00.000.log")
+	if err := os.WriteFile(old, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := openRotatingFile(fileConfig{Filename: filepath.Join(dir, "app.log"), MaxSize: 1, MaxAge: telemetry.JSONDuration(24 * time.Hour)})
+	if err != nil {
+		t.Fatalf("openRotatingFile returned error: %v", err)
+	}
+	file.Write([]byte("a"))
+	file.Write([]byte("b"))
+	file.Close()
+
+	if exists(old) {
+		t.Error("wanted backup older than max_age removed")
+	}
+	if backups := rotatedFiles(t, dir); len(backups) != 1 {
+		t.Errorf("wanted the fresh backup kept, got %v", backups)
+	}
+}
+
+func TestJSONDriverStringConfig(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "logs.json")
+	config, _ := json.Marshal(filename)
+
+	driver, err := telemetry.NewDriver("json", config)
+	if err != nil {
+		t.Fatalf("newdriver returned error: %v", err)
+	}
+	if err := driver.Log(telemetry.Log{Message: "hello"}); err != nil {
+		t.Fatalf("log returned error: %v", err)
+	}
+	driver.Close()
+
+	if !exists(filename) {
+		t.Error("wanted log file created from plain filename config")
+	}
+}
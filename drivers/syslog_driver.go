@@ -0,0 +1,417 @@
+package drivers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/annwyl/telemetry/telemetry"
+)
+
+const (
+	defaultSyslogTimeout = 5 * time.Second
+	// 32473 is the enterprise number reserved for documentation, RFC 5612
+	defaultSyslogSDID = "tags@32473"
+	syslogTimeFormat  = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+// local syslog sockets, in the order they are tried
+var syslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+type syslogConfig struct {
+	Network  string                 `json:"network" jsonschema:"enum=udp|tcp|tls|unix"`
+	Address  string                 `json:"address"`
+	Facility string                 `json:"facility"`
+	AppName  string                 `json:"app_name"`
+	Hostname string                 `json:"hostname"`
+	SDID     string                 `json:"sd_id"`
+	Timeout  telemetry.JSONDuration `json:"timeout"`
+	TLS      syslogTLSConfig        `json:"tls"`
+}
+
+type syslogTLSConfig struct {
+	CAFile             string `json:"ca_file"`
+	CertFile           string `json:"cert_file"`
+	KeyFile            string `json:"key_file"`
+	ServerName         string `json:"server_name"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+}
+
+// SyslogDriver writes RFC 5424 messages to a syslog server over udp, tcp,
+// tls or a local unix socket. Tags and fields are sent as structured data.
+// When a write fails the driver reconnects and tries once more.
+type SyslogDriver struct {
+	network   string
+	address   string
+	tlsConfig *tls.Config
+	timeout   time.Duration
+
+	facility int
+	hostname string
+	appName  string
+	procID   string
+	sdID     string
+
+	mutex  sync.Mutex
+	conn   net.Conn
+	closed bool
+	// framing of the current connection, it depends on what was dialed
+	octetCounting bool
+	newline       bool
+}
+
+func init() {
+	err := telemetry.RegisterDriver("syslog", func(config json.RawMessage) (telemetry.Driver, error) {
+		var cfg syslogConfig
+		if err := telemetry.DecodeStrict(config, &cfg); err != nil {
+			return nil, err
+		}
+		return newSyslogDriver(cfg)
+	})
+	if err != nil {
+		panic(err)
+	}
+	err = telemetry.RegisterDriverValidator("syslog", strictValidator(func() driverConfig { return &syslogConfig{} }))
+	if err != nil {
+		panic(err)
+	}
+	err = telemetry.RegisterDriverSchema("syslog", telemetry.SchemaFor(syslogConfig{}))
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (c syslogConfig) validate() error {
+	var errs telemetry.ConfigErrors
+	if c.SDID != "" && !validSDName(c.SDID) {
+		errs.Add("sd_id", "invalid syslog sd_id %q", c.SDID)
+	}
+
+	switch c.Network {
+	case "", "unix":
+	case "udp", "tcp", "tls":
+		if c.Address == "" {
+			errs.Add("address", "syslog address required for %s", c.Network)
+		}
+	default:
+		errs.Add("network", "unknown syslog network %q", c.Network)
+	}
+	if c.Network == "tls" {
+		if _, err := c.TLS.load(); err != nil {
+			errs.Add("tls", "%v", err)
+		}
+	}
+
+	if _, ok := syslogFacilities[c.Facility]; !ok && c.Facility != "" {
+		errs.Add("facility", "unknown syslog facility %q", c.Facility)
+	}
+	return errs.Err()
+}
+
+func newSyslogDriver(cfg syslogConfig) (*SyslogDriver, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	driver := &SyslogDriver{
+		network: cfg.Network,
+		address: cfg.Address,
+		timeout: time.Duration(cfg.Timeout),
+		procID:  strconv.Itoa(os.Getpid()),
+		sdID:    cfg.SDID,
+	}
+	if driver.timeout <= 0 {
+		driver.timeout = defaultSyslogTimeout
+	}
+	if driver.sdID == "" {
+		driver.sdID = defaultSyslogSDID
+	}
+
+	switch driver.network {
+	case "":
+		driver.network = "unix"
+	case "tls":
+		tlsConfig, err := cfg.TLS.load()
+		if err != nil {
+			return nil, err
+		}
+		driver.tlsConfig = tlsConfig
+	}
+
+	facility := cfg.Facility
+	if facility == "" {
+		facility = "user"
+	}
+	code := syslogFacilities[facility]
+	driver.facility = code
+
+	driver.hostname = cfg.Hostname
+	if driver.hostname == "" {
+		driver.hostname, _ = os.Hostname()
+	}
+	driver.appName = cfg.AppName
+	if driver.appName == "" {
+		driver.appName = filepath.Base(os.Args[0])
+	}
+
+	if err := driver.connect(); err != nil {
+		return nil, err
+	}
+	return driver, nil
+}
+
+func (c syslogTLSConfig) load() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read syslog ca_file: %v", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in syslog ca_file %s", c.CAFile)
+		}
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load syslog client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// connect dials the server, the caller holds the mutex or owns the driver.
+func (s *SyslogDriver) connect() error {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+
+	switch s.network {
+	case "unix":
+		return s.connectUnix()
+	case "tls":
+		dialer := &net.Dialer{Timeout: s.timeout}
+		conn, err := tls.DialWithDialer(dialer, "tcp", s.address, s.tlsConfig)
+		if err != nil {
+			return fmt.Errorf("failed to connect to syslog: %w", err)
+		}
+		s.conn, s.octetCounting, s.newline = conn, true, false
+	default:
+		conn, err := net.DialTimeout(s.network, s.address, s.timeout)
+		if err != nil {
+			return fmt.Errorf("failed to connect to syslog: %w", err)
+		}
+		s.conn, s.octetCounting, s.newline = conn, s.network == "tcp", false
+	}
+	return nil
+}
+
+// connectUnix tries the datagram socket first, then the stream socket where
+// messages are separated by newlines, for each of the usual paths.
+func (s *SyslogDriver) connectUnix() error {
+	paths := syslogSockets
+	if s.address != "" {
+		paths = []string{s.address}
+	}
+
+	var lastErr error
+	for _, path := range paths {
+		for _, network := range []string{"unixgram", "unix"} {
+			conn, err := net.DialTimeout(network, path, s.timeout)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			s.conn, s.octetCounting, s.newline = conn, false, network == "unix"
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to connect to local syslog: %w", lastErr)
+}
+
+func (s *SyslogDriver) Log(log telemetry.Log) error {
+	message := s.format(log)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return fmt.Errorf("syslog driver closed")
+	}
+
+	err := s.write(message)
+	if err == nil {
+		return nil
+	}
+
+	// the server may have gone away, reconnect and try once more
+	if connectErr := s.connect(); connectErr != nil {
+		return fmt.Errorf("syslog write failed: %v: %w", err, connectErr)
+	}
+	return s.write(message)
+}
+
+func (s *SyslogDriver) write(message []byte) error {
+	if s.conn == nil {
+		return fmt.Errorf("syslog not connected")
+	}
+
+	frame := message
+	switch {
+	case s.octetCounting:
+		frame = append([]byte(strconv.Itoa(len(message))+" "), message...)
+	case s.newline:
+		frame = append(message, '\n')
+	}
+
+	s.conn.SetWriteDeadline(time.Now().Add(s.timeout))
+	_, err := s.conn.Write(frame)
+	return err
+}
+
+// format builds <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG.
+func (s *SyslogDriver) format(log telemetry.Log) []byte {
+	timestamp := "-"
+	if !log.Timestamp.IsZero() {
+		timestamp = log.Timestamp.Format(syslogTimeFormat)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %s - ",
+		s.facility*8+syslogSeverity(log.Level),
+		timestamp,
+		syslogHeaderField(s.hostname, 255),
+		syslogHeaderField(s.appName, 48),
+		syslogHeaderField(s.procID, 128),
+	)
+	b.WriteString(s.structuredData(log))
+	if log.Message != "" {
+		b.WriteByte(' ')
+		b.WriteString(log.Message)
+	}
+	return []byte(b.String())
+}
+
+// structuredData puts tags, fields and transaction IDs into one element,
+// sorted by name. Names that aren't valid SD-NAMEs are left out.
+func (s *SyslogDriver) structuredData(log telemetry.Log) string {
+	params := log.StringValues()
+	if log.TransactionID != "" {
+		params["transaction_id"] = log.TransactionID
+	}
+	if log.ParentID != "" {
+		params["parent_id"] = log.ParentID
+	}
+	if log.TraceID != "" {
+		params["trace_id"] = log.TraceID
+	}
+
+	names := make([]string, 0, len(params))
+	for name := range params {
+		if validSDName(name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "-"
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteByte('[')
+	b.WriteString(s.sdID)
+	for _, name := range names {
+		fmt.Fprintf(&b, " %s=\"%s\"", name, escapeSDValue(params[name]))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+func syslogSeverity(level telemetry.LogLevel) int {
+	switch level {
+	case telemetry.TraceLevel, telemetry.DebugLevel:
+		return 7
+	case telemetry.InfoLevel:
+		return 6
+	case telemetry.WarningLevel:
+		return 4
+	case telemetry.ErrorLevel:
+		return 3
+	case telemetry.PanicLevel, telemetry.FatalLevel:
+		return 2
+	}
+	return 5
+}
+
+// syslogHeaderField keeps printable ASCII without spaces and cuts it to the
+// maximum length, an empty field is written as "-".
+func syslogHeaderField(value string, max int) string {
+	var b strings.Builder
+	for i := 0; i < len(value) && b.Len() < max; i++ {
+		if value[i] >= 33 && value[i] <= 126 {
+			b.WriteByte(value[i])
+		}
+	}
+	if b.Len() == 0 {
+		return "-"
+	}
+	return b.String()
+}
+
+// validSDName is 1 to 32 printable ASCII characters except '=', ' ', ']'
+// and '"'.
+func validSDName(name string) bool {
+	if len(name) == 0 || len(name) > 32 {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c < 33 || c > 126 || c == '=' || c == ']' || c == '"' {
+			return false
+		}
+	}
+	return true
+}
+
+var sdValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+func escapeSDValue(value string) string {
+	return sdValueEscaper.Replace(value)
+}
+
+func (s *SyslogDriver) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.closed = true
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
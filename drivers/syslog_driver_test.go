@@ -0,0 +1,252 @@
+package drivers
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/annwyl/telemetry/telemetry"
+)
+
+var syslogTestLog = telemetry.Log{
+	Timestamp:     time.Date(2024, 3, 1, 12, 30, 0, 123456000, time.UTC),
+	Level:         telemetry.WarningLevel,
+	Message:       "disk almost full",
+	Tags:          map[string]string{"mount": "/var", "note": `say "hi" [x]`},
+	Fields:        telemetry.Fields{telemetry.Int("percent", 93)},
+	TransactionID: "abc",
+}
+
+func TestSyslogFormat(t *testing.T) {
+	driver := &SyslogDriver{facility: 16, hostname: "web 1", appName: "api", procID: "42", sdID: defaultSyslogSDID}
+
+	got := string(driver.format(syslogTestLog))
+	want := `<132>1 2024-03-01T12:30:00.123456Z web1 api 42 - [tags@32473 mount="/var" note="say \"hi\" [x\]" percent="93" transaction_id="abc"] disk almost full`
+	if got != want {
+		t.Errorf("unexpected message\nwant %s\ngot  %s", want, got)
+	}
+
+	empty := string(driver.format(telemetry.Log{Level: telemetry.DebugLevel}))
+	if empty != "<135>1 - web1 api 42 - -" {
+		t.Errorf("unexpected message without data %q", empty)
+	}
+}
+
+func TestSyslogConfig(t *testing.T) {
+	tests := []syslogConfig{
+		{Network: "udp"},
+		{Network: "carrier-pigeon", Address: "localhost:514"},
+		{Network: "udp", Address: "localhost:514", Facility: "local9"},
+		{Network: "udp", Address: "localhost:514", SDID: "has space"},
+	}
+	for _, cfg := range tests {
+		if _, err := newSyslogDriver(cfg); err == nil {
+			t.Errorf("wanted error for %+v", cfg)
+		}
+	}
+}
+
+func TestSyslogUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen returned error: %v", err)
+	}
+	defer conn.Close()
+
+	driver, err := newSyslogDriver(syslogConfig{Network: "udp", Address: conn.LocalAddr().String(), Facility: "local0", AppName: "api"})
+	if err != nil {
+		t.Fatalf("newSyslogDriver returned error: %v", err)
+	}
+	defer driver.Close()
+
+	if err := driver.Log(syslogTestLog); err != nil {
+		t.Fatalf("log returned error: %v", err)
+	}
+
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("read returned error: %v", err)
+	}
+	if message := string(buf[:n]); !strings.HasPrefix(message, "<132>1 ") || !strings.HasSuffix(message, " disk almost full") {
+		t.Errorf("unexpected datagram %q", message)
+	}
+}
+
+// readOctetCounted reads one "LEN SP MSG" frame.
+func readOctetCounted(r *bufio.Reader) (string, error) {
+	length, err := r.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(length))
+	if err != nil {
+		return "", err
+	}
+	message := make([]byte, n)
+	_, err = io.ReadFull(r, message)
+	return string(message), err
+}
+
+func TestSyslogTCPReconnect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen returned error: %v", err)
+	}
+	defer listener.Close()
+
+	driver, err := newSyslogDriver(syslogConfig{Network: "tcp", Address: listener.Addr().String()})
+	if err != nil {
+		t.Fatalf("newSyslogDriver returned error: %v", err)
+	}
+	defer driver.Close()
+
+	first, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("accept returned error: %v", err)
+	}
+
+	driver.Log(telemetry.Log{Message: "one"})
+	driver.Log(telemetry.Log{Message: "two"})
+	reader := bufio.NewReader(first)
+	for _, want := range []string{"one", "two"} {
+		message, err := readOctetCounted(reader)
+		if err != nil || !strings.HasSuffix(message, " "+want) {
+			t.Fatalf("wanted framed message %s, got %q %v", want, message, err)
+		}
+	}
+
+	// the server drops the connection, writes fail once the peer resets it
+	// and the driver has to dial again
+	first.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		driver.Log(telemetry.Log{Message: "again"})
+		select {
+		case second := <-accepted:
+			defer second.Close()
+			second.SetReadDeadline(time.Now().Add(2 * time.Second))
+			message, err := readOctetCounted(bufio.NewReader(second))
+			if err != nil || !strings.HasSuffix(message, " again") {
+				t.Fatalf("wanted message on new connection, got %q %v", message, err)
+			}
+			return
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("driver didn't reconnect")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSyslogTLS(t *testing.T) {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{testCertificate(t)}})
+	if err != nil {
+		t.Fatalf("listen returned error: %v", err)
+	}
+	defer listener.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		message, _ := readOctetCounted(bufio.NewReader(conn))
+		received <- message
+	}()
+
+	driver, err := newSyslogDriver(syslogConfig{
+		Network: "tls",
+		Address: listener.Addr().String(),
+		TLS:     syslogTLSConfig{InsecureSkipVerify: true},
+	})
+	if err != nil {
+		t.Fatalf("newSyslogDriver returned error: %v", err)
+	}
+	defer driver.Close()
+
+	if err := driver.Log(syslogTestLog); err != nil {
+		t.Fatalf("log returned error: %v", err)
+	}
+	select {
+	case message := <-received:
+		if !strings.HasSuffix(message, " disk almost full") {
+			t.Errorf("unexpected message %q", message)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("nothing received over tls")
+	}
+}
+
+func TestSyslogUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	conn, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Skipf("unixgram not supported: %v", err)
+	}
+	defer conn.Close()
+
+	driver, err := newSyslogDriver(syslogConfig{Network: "unix", Address: path})
+	if err != nil {
+		t.Fatalf("newSyslogDriver returned error: %v", err)
+	}
+	defer driver.Close()
+
+	if err := driver.Log(telemetry.Log{Level: telemetry.ErrorLevel, Message: "local"}); err != nil {
+		t.Fatalf("log returned error: %v", err)
+	}
+
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("read returned error: %v", err)
+	}
+	if message := string(buf[:n]); !strings.HasPrefix(message, "<11>1 ") || !strings.HasSuffix(message, " local") {
+		t.Errorf("unexpected datagram %q", message)
+	}
+}
+
+func testCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key returned error: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "syslog"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate returned error: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
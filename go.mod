@@ -2,7 +2,11 @@ module github.com/annwyl/telemetry
 
 go 1.22.6
 
-require github.com/elastic/go-elasticsearch/v8 v8.15.0
+require (
+	github.com/BurntSushi/toml v1.4.0
+	github.com/elastic/go-elasticsearch/v8 v8.15.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/elastic/elastic-transport-go/v8 v8.6.0 // indirect
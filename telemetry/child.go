@@ -0,0 +1,101 @@
+package telemetry
+
+import (
+	"path"
+	"strings"
+)
+
+// Named returns a child logger for a component. Names of nested children are
+// joined with dots, like "payments.stripe", and are added to every entry
+// under the "logger" tag. The child's level comes from the components
+// section of the config, unless it is set with SetLogLevel.
+func (l *Logger) Named(name string) *Logger {
+	child := l.child()
+	if l.name != "" {
+		name = l.name + "." + name
+	}
+	child.name = name
+	return child
+}
+
+// With returns a child logger that adds tags to every entry. They override
+// the default tags, and tags passed to a log call override them.
+func (l *Logger) With(tags map[string]string) *Logger {
+	child := l.child()
+	child.tags = make(map[string]string, len(l.tags)+len(tags))
+	for k, v := range l.tags {
+		child.tags[k] = v
+	}
+	for k, v := range tags {
+		child.tags[k] = v
+	}
+	return child
+}
+
+// child copies the name, tags and level of l. All other state, like the
+// driver and the transactions, stays with the root logger.
+func (l *Logger) child() *Logger {
+	root := l.root()
+
+	root.mutex.Lock()
+	defer root.mutex.Unlock()
+
+	child := &Logger{parent: root, name: l.name, tags: l.tags}
+	if l.level != nil {
+		level := *l.level
+		child.level = &level
+	}
+	return child
+}
+
+func (l *Logger) root() *Logger {
+	if l.parent != nil {
+		return l.parent
+	}
+	return l
+}
+
+// levelFor is the minimum level of source, the caller holds the mutex.
+func (l *Logger) levelFor(source *Logger) LogLevel {
+	if source.level != nil {
+		return *source.level
+	}
+	if source.name != "" {
+		if level, ok := componentLevel(l.config.Components, source.name); ok {
+			return level
+		}
+	}
+	return l.config.LogLevel
+}
+
+// componentLevel finds the level for a logger name. A pattern matches the
+// name or one of its parents, so "payments" also covers "payments.stripe",
+// and may use path.Match wildcards like "db.*". The longest pattern wins.
+func componentLevel(components map[string]LogLevel, name string) (LogLevel, bool) {
+	var best string
+	var level LogLevel
+	found := false
+
+	for pattern, patternLevel := range components {
+		if !matchComponent(pattern, name) {
+			continue
+		}
+		if !found || len(pattern) > len(best) || (len(pattern) == len(best) && pattern < best) {
+			best, level, found = pattern, patternLevel, true
+		}
+	}
+	return level, found
+}
+
+func matchComponent(pattern, name string) bool {
+	for {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		i := strings.LastIndexByte(name, '.')
+		if i < 0 {
+			return false
+		}
+		name = name[:i]
+	}
+}
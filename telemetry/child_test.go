@@ -0,0 +1,99 @@
+package telemetry
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+)
+
+func TestNamedAndWith(t *testing.T) {
+	logger, mockDriver := newTransactionTestLogger(Config{
+		LogLevel:    InfoLevel,
+		DefaultTags: map[string]string{"environment": "test", "region": "eu"},
+	})
+
+	payments := logger.Named("payments").With(map[string]string{"region": "us", "team": "billing"})
+	stripe := payments.Named("stripe")
+
+	transactionID := stripe.StartTransaction()
+	stripe.Info("charged", map[string]string{"team": "payments"}, transactionID)
+
+	if len(mockDriver.logs) != 1 {
+		t.Fatalf("wanted 1 log, got %d", len(mockDriver.logs))
+	}
+	tags := mockDriver.logs[0].Tags
+	if tags["logger"] != "payments.stripe" || tags["environment"] != "test" || tags["region"] != "us" || tags["team"] != "payments" {
+		t.Errorf("unexpected tags %v", tags)
+	}
+	if logger.OpenTransactions() != 1 {
+		t.Error("wanted child transactions kept by the root logger")
+	}
+
+	logger.Info("root", nil)
+	if tags := mockDriver.logs[1].Tags; tags["logger"] != "" || tags["team"] != "" {
+		t.Errorf("child tags leaked into the root logger: %v", tags)
+	}
+
+	if err := payments.Close(); err != nil {
+		t.Fatalf("close returned error: %v", err)
+	}
+	if err := logger.Info("still open", nil); err != nil || len(mockDriver.logs) != 3 {
+		t.Error("closing a child should leave the root alone")
+	}
+}
+
+func TestChildLevels(t *testing.T) {
+	logger, mockDriver := newTransactionTestLogger(Config{
+		LogLevel: WarningLevel,
+		Components: map[string]LogLevel{
+			"payments":   DebugLevel,
+			"payments.*": ErrorLevel,
+			"db.*":       InfoLevel,
+		},
+	})
+
+	logger.Named("payments").Debug("payments debug", nil)
+	logger.Named("payments").Named("stripe").Warning("longest pattern wins", nil)
+	logger.Named("db").Named("pool").Info("db info", nil)
+	logger.Named("cache").Info("cache info", nil)
+	logger.Info("root info", nil)
+
+	if len(mockDriver.logs) != 2 || mockDriver.logs[0].Message != "payments debug" || mockDriver.logs[1].Message != "db info" {
+		t.Fatalf("unexpected logs %v", mockDriver.logs)
+	}
+
+	cache := logger.Named("cache")
+	cache.SetLogLevel(DebugLevel)
+	cache.Debug("cache debug", nil)
+	cache.Named("redis").Debug("inherited override", nil)
+	logger.Info("root still at warning", nil)
+
+	if len(mockDriver.logs) != 4 || mockDriver.logs[3].Message != "inherited override" {
+		t.Errorf("wanted the override on the child and its children only, got %v", mockDriver.logs)
+	}
+}
+
+func TestChildSlogHandler(t *testing.T) {
+	logger, mockDriver := newTransactionTestLogger(Config{LogLevel: WarningLevel, Components: map[string]LogLevel{"http": DebugLevel}})
+
+	slogger := slog.New(NewSlogHandler(logger.Named("http")))
+	if !slogger.Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("wanted the component level used by Enabled")
+	}
+	slogger.Debug("handled")
+
+	if len(mockDriver.logs) != 1 || mockDriver.logs[0].Tags["logger"] != "http" {
+		t.Errorf("unexpected logs %v", mockDriver.logs)
+	}
+}
+
+func TestComponentValidation(t *testing.T) {
+	config := Config{
+		Name:       "mock",
+		Config:     []byte(`{}`),
+		Components: map[string]LogLevel{"[": DebugLevel, "ok": LogLevel(42)},
+	}
+	if err := validateConfig(config); err == nil {
+		t.Error("wanted error for bad pattern and level")
+	}
+}
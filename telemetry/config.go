@@ -4,69 +4,276 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path"
+	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 )
 
 type Config struct {
-	Name        string            `json:"driver"`
-	Config      json.RawMessage   `json:"driver_config"`
-	LogLevel    LogLevel          `json:"log_level"`
-	DefaultTags map[string]string `json:"default_tags"`
+	Name         string              `json:"driver"`
+	Config       json.RawMessage     `json:"driver_config"`
+	LogLevel     LogLevel            `json:"log_level"`
+	Components   map[string]LogLevel `json:"components,omitempty"`
+	DefaultTags  map[string]string   `json:"default_tags"`
+	Buffer       *BufferConfig       `json:"buffer,omitempty"`
+	Retry        *RetryConfig        `json:"retry,omitempty"`
+	Transactions TransactionConfig   `json:"transactions"`
+	Sampling     *SamplingConfig     `json:"sampling,omitempty"`
 }
 
-func LoadConfig(filename string) (Config, error) {
-	var config Config
-	file, err := os.Open(filename)
+// JSONDuration is a time.Duration that is written in config files as a
+// string, like "500ms" or "5s".
+type JSONDuration time.Duration
+
+func (d JSONDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *JSONDuration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string like \"5s\": %v", err)
+	}
+	parsed, err := time.ParseDuration(value)
 	if err != nil {
-		return config, fmt.Errorf("failed to open config file: %v", err)
+		return err
 	}
-	defer file.Close()
+	*d = JSONDuration(parsed)
+	return nil
+}
 
-	decoder := json.NewDecoder(file)
-	err = decoder.Decode(&config)
-	if err != nil {
-		return config, fmt.Errorf("failed to decode config file: %v", err)
+// DefaultConfig is the bottom layer of LoadConfig. The level is debug, like
+// it always was for config files without log_level, and DefaultTags is empty
+// but not nil so overrides can add tags.
+func DefaultConfig() Config {
+	return Config{LogLevel: DebugLevel, DefaultTags: make(map[string]string)}
+}
+
+// LoadConfig builds a config in layers, each overriding the ones before:
+// DefaultConfig, the JSON file, the TELEMETRY_ environment variables and
+// then the overrides, in order. The file is skipped when filename is empty,
+// it is read as YAML or TOML when its extension says so and as JSON
+// otherwise.
+// ${NAME} in driver configs is replaced with the environment variable.
+//
+// Unknown fields are an error. Every problem found, in the generic and the
+// driver specific settings, is returned at once as ConfigErrors.
+func LoadConfig(filename string, overrides ...func(*Config)) (Config, error) {
+	config := DefaultConfig()
+	var problems ConfigErrors
+
+	if filename != "" {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return config, fmt.Errorf("failed to open config file: %v", err)
+		}
+
+		data, err = configToJSON(filename, data)
+		if err == nil {
+			var syntax any
+			err = json.Unmarshal(data, &syntax)
+		}
+		if err != nil {
+			return config, fmt.Errorf("failed to decode config file: %w", err)
+		}
+
+		decodeErr, unknown := decodeStrict(data, &config)
+		if decodeErr != nil {
+			// the values after the broken one are missing, checking them
+			// would only add noise
+			return config, fmt.Errorf("invalid config: %w", append(ConfigErrors{decodeErr}, unknown...))
+		}
+		problems = unknown
 	}
 
-	err = validateConfig(config)
-	if err != nil {
-		return config, fmt.Errorf("invalid config: %v", err)
+	if err := applyEnv(&config); err != nil {
+		problems.Add("log_level", "%v", err)
 	}
 
+	problems = append(problems, expandConfigEnv(&config)...)
+
+	for _, override := range overrides {
+		override(&config)
+	}
+
+	if err := validateConfig(config); err != nil {
+		problems = append(problems, asConfigErrors(err)...)
+	}
+
+	if len(problems) > 0 {
+		return config, fmt.Errorf("invalid config: %w", problems)
+	}
 	return config, nil
 }
 
+// configToJSON converts YAML and TOML config files to JSON, so every format
+// is decoded the same way and driver_config reaches the driver as JSON.
+func configToJSON(filename string, data []byte) ([]byte, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return yamlToJSON(data)
+	case ".toml":
+		return tomlToJSON(data)
+	}
+	return data, nil
+}
+
+func expandConfigEnv(config *Config) ConfigErrors {
+	var errs ConfigErrors
+	if expanded, err := expandEnv(config.Config); err != nil {
+		errs.Add("driver_config", "%v", err)
+	} else {
+		config.Config = expanded
+	}
+
+	if config.Retry != nil && config.Retry.DeadLetter != nil {
+		if expanded, err := expandEnv(config.Retry.DeadLetter.Config); err != nil {
+			errs.Add("retry.dead_letter.driver_config", "%v", err)
+		} else {
+			config.Retry.DeadLetter.Config = expanded
+		}
+	}
+	return errs
+}
+
+// validateConfig checks the generic settings and, through the registered
+// validators, the driver_config of the driver and the dead letter driver.
 func validateConfig(config Config) error {
-	var errors []string
+	var errs ConfigErrors
 
 	if config.Name == "" {
-		errors = append(errors, "no driver specified")
+		errs.Add("driver", "no driver specified")
 	}
 
 	if len(config.Config) == 0 {
-		errors = append(errors, "empty config")
+		errs.Add("driver_config", "empty config")
+	} else if config.Name != "" {
+		errs = append(errs, ValidateDriverConfig(config.Name, config.Config).Within("driver_config")...)
 	}
 
-	if config.LogLevel < 0 || config.LogLevel > 3 {
-		errors = append(errors, "invalid log level")
+	if !config.LogLevel.valid() {
+		errs.Add("log_level", "invalid log level: %d (must be between %d and %d)", config.LogLevel, TraceLevel, FatalLevel)
 	}
 
-	if config.LogLevel < DebugLevel || config.LogLevel > ErrorLevel {
-		errors = append(errors, fmt.Sprintf("invalid log level: %d (must be between %d and %d)", config.LogLevel, DebugLevel, ErrorLevel))
+	patterns := make([]string, 0, len(config.Components))
+	for pattern := range config.Components {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			errs.Add(keyPath("components", pattern), "invalid component pattern")
+		}
+		if level := config.Components[pattern]; !level.valid() {
+			errs.Add(keyPath("components", pattern), "invalid log level: %d", level)
+		}
 	}
 
-	for key, value := range config.DefaultTags {
+	if config.Buffer != nil {
+		if config.Buffer.QueueSize < 0 {
+			errs.Add("buffer.queue_size", "buffer queue size can't be negative")
+		}
+		if config.Buffer.FlushInterval < 0 {
+			errs.Add("buffer.flush_interval", "buffer flush interval can't be negative")
+		}
+		switch config.Buffer.Overflow {
+		case "", OverflowBlock, OverflowDropNewest, OverflowDropOldest:
+		default:
+			errs.Add("buffer.overflow", "invalid buffer overflow policy: %s", config.Buffer.Overflow)
+		}
+	}
+
+	if config.Retry != nil {
+		errs = append(errs, ValidateRetryConfig(*config.Retry).Within("retry")...)
+	}
+
+	if level := config.Transactions.SummaryLevel; level != nil && !level.valid() {
+		errs.Add("transactions.summary_level", "invalid transaction summary level: %d", *level)
+	}
+
+	if config.Transactions.LatencyThreshold < 0 {
+		errs.Add("transactions.latency_threshold", "transaction latency threshold can't be negative")
+	}
+
+	if config.Transactions.MaxAge < 0 {
+		errs.Add("transactions.max_age", "transaction max age can't be negative")
+	}
+	if config.Transactions.ReapInterval < 0 {
+		errs.Add("transactions.reap_interval", "transaction reap interval can't be negative")
+	}
+
+	if sampling := config.Sampling; sampling != nil {
+		validateSamplingRule(sampling.SamplingRule, "sampling", &errs)
+		if sampling.Tick < 0 {
+			errs.Add("sampling.tick", "sampling tick can't be negative")
+		}
+		levels := make([]LogLevel, 0, len(sampling.Levels))
+		for level := range sampling.Levels {
+			levels = append(levels, level)
+		}
+		sort.Slice(levels, func(i, j int) bool { return levels[i] < levels[j] })
+		for _, level := range levels {
+			validateSamplingRule(sampling.Levels[level], keyPath("sampling.levels", level.String()), &errs)
+		}
+		if sampling.RateLimit < 0 {
+			errs.Add("sampling.rate_limit", "sampling rate limit can't be negative")
+		}
+		if sampling.Burst < 0 {
+			errs.Add("sampling.burst", "sampling burst can't be negative")
+		}
+		if sampling.SummaryInterval < 0 {
+			errs.Add("sampling.summary_interval", "sampling summary interval can't be negative")
+		}
+	}
+
+	for _, key := range sortedKeys(config.DefaultTags) {
 		if key == "" {
-			errors = append(errors, "default tag has empty key")
+			errs.Add("default_tags", "default tag has empty key")
 		}
-		if value == "" {
-			errors = append(errors, "default tag has empty value")
+		if config.DefaultTags[key] == "" {
+			errs.Add(keyPath("default_tags", key), "default tag has empty value")
 		}
 	}
 
-	if len(errors) > 0 {
-		return fmt.Errorf("config validation failed: %s", strings.Join(errors, "; "))
+	return errs.Err()
+}
+
+func validateSamplingRule(rule SamplingRule, path string, errs *ConfigErrors) {
+	if rule.Initial < 0 {
+		errs.Add(joinPath(path, "initial"), "sampling initial can't be negative")
 	}
+	if rule.Thereafter < 0 {
+		errs.Add(joinPath(path, "thereafter"), "sampling thereafter can't be negative")
+	}
+}
 
-	return nil
+// ValidateRetryConfig checks a retry section and its dead letter driver,
+// drivers that wrap their children in a RetryDriver use it.
+func ValidateRetryConfig(config RetryConfig) ConfigErrors {
+	var errs ConfigErrors
+	if config.MaxAttempts < 0 {
+		errs.Add("max_attempts", "retry max attempts can't be negative")
+	}
+	if config.InitialBackoff < 0 {
+		errs.Add("initial_backoff", "retry backoff can't be negative")
+	}
+	if config.MaxBackoff < 0 {
+		errs.Add("max_backoff", "retry backoff can't be negative")
+	}
+	if config.Multiplier < 0 {
+		errs.Add("multiplier", "retry multiplier can't be negative")
+	}
+	if config.Jitter < 0 || config.Jitter > 1 {
+		errs.Add("jitter", "retry jitter must be between 0 and 1")
+	}
+	if deadLetter := config.DeadLetter; deadLetter != nil {
+		if deadLetter.Name == "" {
+			errs.Add("dead_letter.driver", "no dead letter driver specified")
+		} else {
+			errs = append(errs, ValidateDriverConfig(deadLetter.Name, deadLetter.Config).Within("dead_letter.driver_config")...)
+		}
+	}
+	return errs
 }
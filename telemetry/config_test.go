@@ -1,7 +1,11 @@
 package telemetry
 
 import (
+	"encoding/json"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -95,3 +99,150 @@ func TestMissingConfig(t *testing.T) {
 		t.Fatal("wanted error, got nil")
 	}
 }
+
+func TestLoadConfigLayers(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.json")
+	content := `{
+		"driver": "elasticsearch",
+		"driver_config": {"host": "${ES_HOST:-http://localhost:9200}", "password": "${ES_PASSWORD}", "index": "$${literal}"},
+		"log_level": "debug",
+		"default_tags": {"environment": "development", "region": "eu"}
+	}`
+	if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("ES_PASSWORD", `se"cret`)
+	t.Setenv("TELEMETRY_LOG_LEVEL", "warn")
+	t.Setenv("TELEMETRY_DEFAULT_TAGS_ENVIRONMENT", "production")
+	t.Setenv("TELEMETRY_DEFAULT_TAGS_REGION", "")
+
+	config, err := LoadConfig(filename, func(config *Config) {
+		config.DefaultTags["pod"] = "web-1"
+	})
+	if err != nil {
+		t.Fatalf("loadconfig returned error: %v", err)
+	}
+
+	if config.LogLevel != WarningLevel {
+		t.Errorf("wanted the environment to override the file level, got %v", config.LogLevel)
+	}
+	want := map[string]string{"environment": "production", "pod": "web-1"}
+	if !reflect.DeepEqual(config.DefaultTags, want) {
+		t.Errorf("wanted tags %v, got %v", want, config.DefaultTags)
+	}
+
+	var driverConfig map[string]string
+	if err := json.Unmarshal(config.Config, &driverConfig); err != nil {
+		t.Fatalf("expanded driver config isn't valid json: %v", err)
+	}
+	if driverConfig["password"] != `se"cret` || driverConfig["host"] != "http://localhost:9200" || driverConfig["index"] != "${literal}" {
+		t.Errorf("unexpected driver config %v", driverConfig)
+	}
+}
+
+func TestLoadConfigWithoutFile(t *testing.T) {
+	t.Setenv("TELEMETRY_DRIVER", "json")
+	t.Setenv("TELEMETRY_DRIVER_CONFIG", "logs.json")
+
+	config, err := LoadConfig("")
+	if err != nil {
+		t.Fatalf("loadconfig returned error: %v", err)
+	}
+	if config.Name != "json" || string(config.Config) != `"logs.json"` || config.LogLevel != DebugLevel {
+		t.Errorf("unexpected config %+v", config)
+	}
+	// overrides and AddDefaultTag can add tags without a default_tags section
+	config, err = LoadConfig("", func(config *Config) {
+		config.DefaultTags["pod"] = "web-1"
+	})
+	if err != nil || config.DefaultTags["pod"] != "web-1" {
+		t.Errorf("wanted the override to add a tag, got %v, %v", config.DefaultTags, err)
+	}
+
+	t.Setenv("TELEMETRY_LOG_LEVEL", "loud")
+	if _, err := LoadConfig(""); err == nil {
+		t.Error("wanted error for invalid level in the environment")
+	}
+}
+
+func TestLoadConfigMissingVariable(t *testing.T) {
+	t.Setenv("TELEMETRY_DRIVER", "elasticsearch")
+	t.Setenv("TELEMETRY_DRIVER_CONFIG", `{"password": "${TELEMETRY_TEST_UNSET}"}`)
+
+	_, err := LoadConfig("")
+	if err == nil || !strings.Contains(err.Error(), "TELEMETRY_TEST_UNSET") {
+		t.Errorf("wanted error naming the unset variable, got %v", err)
+	}
+}
+
+func TestLoadConfigFormats(t *testing.T) {
+	files := map[string]string{
+		"config.json": `{
+			"driver": "elasticsearch",
+			"driver_config": {"host": "http://localhost:9200", "index": "logs"},
+			"log_level": "warning",
+			"default_tags": {"environment": "test", "app_version": "1.0.0"},
+			"buffer": {"queue_size": 10, "flush_interval": "1s"}
+		}`,
+		"config.yaml": `
+driver: elasticsearch
+driver_config:
+  host: http://localhost:9200
+  index: logs
+log_level: warning
+default_tags:
+  environment: test
+  app_version: "1.0.0"
+buffer: {queue_size: 10, flush_interval: 1s}
+`,
+		"config.toml": `
+driver = "elasticsearch"
+log_level = "warning"
+
+[driver_config]
+host = "http://localhost:9200"
+index = "logs"
+
+[default_tags]
+environment = "test"
+app_version = "1.0.0"
+
+[buffer]
+queue_size = 10
+flush_interval = "1s"
+`,
+	}
+
+	dir := t.TempDir()
+	var configs []Config
+	for name, content := range files {
+		filename := filepath.Join(dir, name)
+		if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		config, err := LoadConfig(filename)
+		if err != nil {
+			t.Fatalf("%s: loadconfig returned error: %v", name, err)
+		}
+
+		var driverConfig map[string]string
+		if err := json.Unmarshal(config.Config, &driverConfig); err != nil || driverConfig["index"] != "logs" {
+			t.Errorf("%s: wanted driver_config as json, got %s", name, config.Config)
+		}
+		config.Config = nil
+		configs = append(configs, config)
+	}
+
+	for _, config := range configs[1:] {
+		if !reflect.DeepEqual(config, configs[0]) {
+			t.Errorf("wanted the same config from every format\n got: %+v\nwant: %+v", config, configs[0])
+		}
+	}
+
+	broken := filepath.Join(dir, "broken.yml")
+	os.WriteFile(broken, []byte("driver: console\n  log_level: info\n"), 0o644)
+	if _, err := LoadConfig(broken); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("wanted error with the line number, got %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package telemetry
+
+import "context"
+
+type contextKey int
+
+const (
+	transactionKey contextKey = iota
+	tagsKey
+)
+
+// ContextExtractor reads a transaction ID and tags from contexts that were
+// filled by something else, like request ID middleware of a web framework.
+type ContextExtractor func(ctx context.Context) (transactionID string, tags map[string]string)
+
+var contextExtractors []ContextExtractor
+
+// RegisterContextExtractor adds an extractor that is asked whenever a
+// context doesn't carry a transaction ID set by this package. Like
+// RegisterDriver it is meant to be called from init.
+func RegisterContextExtractor(extractor ContextExtractor) {
+	contextExtractors = append(contextExtractors, extractor)
+}
+
+// ContextWithTransaction returns a copy of ctx carrying the transaction ID.
+func ContextWithTransaction(ctx context.Context, transactionID string) context.Context {
+	return context.WithValue(ctx, transactionKey, transactionID)
+}
+
+// TransactionFromContext returns the transaction ID carried by ctx, or an
+// empty string if there is none.
+func TransactionFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if transactionID, ok := ctx.Value(transactionKey).(string); ok {
+		return transactionID
+	}
+	for _, extractor := range contextExtractors {
+		if transactionID, _ := extractor(ctx); transactionID != "" {
+			return transactionID
+		}
+	}
+	return ""
+}
+
+// ContextWithTags returns a copy of ctx carrying tags that are added to
+// every entry logged with it. They are merged with tags already in ctx.
+func ContextWithTags(ctx context.Context, tags map[string]string) context.Context {
+	merged := make(map[string]string)
+	if existing, ok := ctx.Value(tagsKey).(map[string]string); ok {
+		for k, v := range existing {
+			merged[k] = v
+		}
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, tagsKey, merged)
+}
+
+// TagsFromContext returns the tags carried by ctx, including tags from
+// registered extractors. The result must not be modified.
+func TagsFromContext(ctx context.Context) map[string]string {
+	if ctx == nil {
+		return nil
+	}
+
+	own, _ := ctx.Value(tagsKey).(map[string]string)
+	if len(contextExtractors) == 0 {
+		return own
+	}
+
+	var tags map[string]string
+	for _, extractor := range contextExtractors {
+		_, extracted := extractor(ctx)
+		if len(extracted) == 0 {
+			continue
+		}
+		if tags == nil {
+			tags = make(map[string]string)
+		}
+		for k, v := range extracted {
+			tags[k] = v
+		}
+	}
+	if tags == nil {
+		return own
+	}
+	for k, v := range own {
+		tags[k] = v
+	}
+	return tags
+}
+
+func mergeTags(base, tags map[string]string) map[string]string {
+	if len(base) == 0 {
+		return tags
+	}
+	if len(tags) == 0 {
+		return base
+	}
+
+	merged := make(map[string]string, len(base)+len(tags))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	return merged
+}
+
+// StartTransactionContext starts a transaction and returns a copy of ctx
+// carrying its ID, so the ...Context logging methods pick it up. If ctx
+// already carries a transaction the new one is nested inside of it.
+func (l *Logger) StartTransactionContext(ctx context.Context) (context.Context, string) {
+	transactionID := l.StartTransaction(TransactionFromContext(ctx))
+	return ContextWithTransaction(ctx, transactionID), transactionID
+}
+
+func (l *Logger) logContext(ctx context.Context, level LogLevel, message string, tags map[string]string, fields []Field) error {
+	return l.log(level, message, mergeTags(TagsFromContext(ctx), tags), fields, TransactionFromContext(ctx))
+}
+
+func (l *Logger) DebugContext(ctx context.Context, message string, tags map[string]string) error {
+	return l.logContext(ctx, DebugLevel, message, tags, nil)
+}
+
+func (l *Logger) InfoContext(ctx context.Context, message string, tags map[string]string) error {
+	return l.logContext(ctx, InfoLevel, message, tags, nil)
+}
+
+func (l *Logger) WarningContext(ctx context.Context, message string, tags map[string]string) error {
+	return l.logContext(ctx, WarningLevel, message, tags, nil)
+}
+
+func (l *Logger) ErrorContext(ctx context.Context, message string, tags map[string]string) error {
+	return l.logContext(ctx, ErrorLevel, message, tags, nil)
+}
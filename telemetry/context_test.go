@@ -0,0 +1,65 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+)
+
+func TestStartTransactionContext(t *testing.T) {
+	logger, mockDriver := newTransactionTestLogger(Config{
+		LogLevel:    DebugLevel,
+		DefaultTags: map[string]string{"environment": "test"},
+	})
+
+	ctx, transactionID := logger.StartTransactionContext(context.Background())
+	if TransactionFromContext(ctx) != transactionID {
+		t.Fatalf("wanted transaction %s in context, got %s", transactionID, TransactionFromContext(ctx))
+	}
+
+	ctx = ContextWithTags(ctx, map[string]string{"user": "1", "environment": "ctx"})
+	ctx = ContextWithTags(ctx, map[string]string{"request": "2"})
+
+	if err := logger.InfoContext(ctx, "with context", map[string]string{"user": "call"}); err != nil {
+		t.Fatalf("infocontext returned error: %v", err)
+	}
+
+	log := mockDriver.logs[0]
+	if log.TransactionID != transactionID {
+		t.Errorf("wanted transaction ID %s, got %s", transactionID, log.TransactionID)
+	}
+	want := map[string]string{"environment": "ctx", "user": "call", "request": "2"}
+	for key, value := range want {
+		if log.Tags[key] != value {
+			t.Errorf("wanted tag %s=%s, got %s", key, value, log.Tags[key])
+		}
+	}
+}
+
+type requestIDKey struct{}
+
+func TestContextExtractor(t *testing.T) {
+	RegisterContextExtractor(func(ctx context.Context) (string, map[string]string) {
+		id, _ := ctx.Value(requestIDKey{}).(string)
+		if id == "" {
+			return "", nil
+		}
+		return id, map[string]string{"request_id": id}
+	})
+
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "req-42")
+	if TransactionFromContext(ctx) != "req-42" {
+		t.Errorf("wanted transaction ID from extractor, got %s", TransactionFromContext(ctx))
+	}
+	if TagsFromContext(ctx)["request_id"] != "req-42" {
+		t.Errorf("wanted tags from extractor, got %v", TagsFromContext(ctx))
+	}
+
+	ctx = ContextWithTransaction(ctx, "own")
+	if TransactionFromContext(ctx) != "own" {
+		t.Errorf("wanted own transaction ID to win, got %s", TransactionFromContext(ctx))
+	}
+
+	if TransactionFromContext(context.Background()) != "" {
+		t.Error("wanted no transaction ID from empty context")
+	}
+}
@@ -26,11 +26,38 @@ func GetRegisteredDrivers() map[string]DriverFactory {
 	return registeredDrivers
 }
 
-func getDriver(config Config) (Driver, error) {
-	factory, ok := registeredDrivers[config.Name]
+// NewDriver creates a registered driver by name, drivers that wrap other
+// drivers use it to build their children.
+func NewDriver(name string, config json.RawMessage) (Driver, error) {
+	factory, ok := registeredDrivers[name]
 	if !ok {
-		return nil, fmt.Errorf("unknown driver: %s", config.Name)
+		return nil, fmt.Errorf("unknown driver: %s", name)
+	}
+
+	return factory(config)
+}
+
+func getDriver(config Config) (Driver, error) {
+	return NewRetryingDriver(config.Name, config.Config, config.Retry)
+}
+
+// NewRetryingDriver creates a registered driver like NewDriver and, when
+// retry isn't nil, wraps it in a RetryDriver with the dead letter driver of
+// retry.
+func NewRetryingDriver(name string, config json.RawMessage, retry *RetryConfig) (Driver, error) {
+	driver, err := NewDriver(name, config)
+	if err != nil || retry == nil {
+		return driver, err
+	}
+
+	var deadLetter Driver
+	if retry.DeadLetter != nil {
+		deadLetter, err = NewDriver(retry.DeadLetter.Name, retry.DeadLetter.Config)
+		if err != nil {
+			driver.Close()
+			return nil, fmt.Errorf("failed to create dead letter driver: %v", err)
+		}
 	}
 
-	return factory(config.Config)
+	return NewRetryDriver(driver, *retry, deadLetter, nil), nil
 }
@@ -0,0 +1,113 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	envPrefix      = "TELEMETRY_"
+	envDefaultTags = envPrefix + "DEFAULT_TAGS_"
+)
+
+// applyEnv overrides config with the TELEMETRY_ environment variables.
+// TELEMETRY_DEFAULT_TAGS_<KEY> sets the tag with the lowercased key, or
+// removes it when the value is empty.
+func applyEnv(config *Config) error {
+	if name, ok := os.LookupEnv(envPrefix + "DRIVER"); ok {
+		config.Name = name
+	}
+
+	if driverConfig, ok := os.LookupEnv(envPrefix + "DRIVER_CONFIG"); ok {
+		// drivers like json take a plain file name
+		if json.Valid([]byte(driverConfig)) {
+			config.Config = json.RawMessage(driverConfig)
+		} else {
+			config.Config, _ = json.Marshal(driverConfig)
+		}
+	}
+
+	if text, ok := os.LookupEnv(envPrefix + "LOG_LEVEL"); ok {
+		level, err := ParseLevel(text)
+		if err != nil {
+			return fmt.Errorf("invalid %sLOG_LEVEL: %v", envPrefix, err)
+		}
+		config.LogLevel = level
+	}
+
+	for _, variable := range os.Environ() {
+		name, value, _ := strings.Cut(variable, "=")
+		if !strings.HasPrefix(name, envDefaultTags) || len(name) == len(envDefaultTags) {
+			continue
+		}
+
+		key := strings.ToLower(strings.TrimPrefix(name, envDefaultTags))
+		if value == "" {
+			delete(config.DefaultTags, key)
+			continue
+		}
+		if config.DefaultTags == nil {
+			config.DefaultTags = make(map[string]string)
+		}
+		config.DefaultTags[key] = value
+	}
+
+	return nil
+}
+
+// expandEnv replaces ${NAME} and ${NAME:-default} in the strings of a raw
+// driver config with the value of the environment variable, and $${ with a
+// literal ${. Variables that are unset and have no default are an error, so
+// a missing secret isn't silently sent as an empty string.
+func expandEnv(config json.RawMessage) (json.RawMessage, error) {
+	text := string(config)
+	if !strings.Contains(text, "${") {
+		return config, nil
+	}
+
+	var builder strings.Builder
+	var missing []string
+	for {
+		i := strings.Index(text, "${")
+		if i < 0 {
+			builder.WriteString(text)
+			break
+		}
+		if i > 0 && text[i-1] == '$' {
+			builder.WriteString(text[:i])
+			builder.WriteString("{")
+			text = text[i+2:]
+			continue
+		}
+
+		end := strings.IndexByte(text[i:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated ${ in driver config")
+		}
+		builder.WriteString(text[:i])
+
+		name, fallback, hasFallback := strings.Cut(text[i+2:i+end], ":-")
+		value, ok := os.LookupEnv(name)
+		switch {
+		case ok:
+		case hasFallback:
+			value = fallback
+		default:
+			missing = append(missing, name)
+		}
+
+		// the value ends up inside a json string
+		quoted, _ := json.Marshal(value)
+		builder.Write(quoted[1 : len(quoted)-1])
+		text = text[i+end+1:]
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("environment variables not set: %s", strings.Join(missing, ", "))
+	}
+	return json.RawMessage(builder.String()), nil
+}
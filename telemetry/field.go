@@ -0,0 +1,121 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Field is a typed tag. Drivers that write JSON keep the native type, so
+// numbers and booleans can be aggregated on instead of being keyword strings.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+func String(key, value string) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Int(key string, value int) Field {
+	return Field{Key: key, Value: int64(value)}
+}
+
+func Int64(key string, value int64) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Float(key string, value float64) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Bool(key string, value bool) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Duration is written to JSON as a number of milliseconds.
+func Duration(key string, value time.Duration) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Time is written to JSON as an RFC 3339 timestamp.
+func Time(key string, value time.Time) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Err adds err under the "error" key, a nil error is written as null.
+func Err(err error) Field {
+	if err == nil {
+		return Field{Key: "error"}
+	}
+	return Field{Key: "error", Value: err}
+}
+
+// Any is for values none of the other constructors fit, it's written with
+// encoding/json.
+func Any(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Tags turns map based tags into fields, for calls that still build a
+// map[string]string.
+func Tags(tags map[string]string) []Field {
+	fields := make([]Field, 0, len(tags))
+	for key, value := range tags {
+		fields = append(fields, String(key, value))
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].Key < fields[j].Key
+	})
+	return fields
+}
+
+// JSONValue is the value in the form it should be encoded as JSON.
+func (f Field) JSONValue() interface{} {
+	switch value := f.Value.(type) {
+	case time.Duration:
+		return float64(value) / float64(time.Millisecond)
+	case time.Time:
+		return value.Format(time.RFC3339Nano)
+	case error:
+		return value.Error()
+	default:
+		return value
+	}
+}
+
+// String is the value formatted for text output.
+func (f Field) String() string {
+	switch value := f.Value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case time.Time:
+		return value.Format(time.RFC3339Nano)
+	case error:
+		return value.Error()
+	case fmt.Stringer:
+		return value.String()
+	case int64, float64, bool:
+		return fmt.Sprint(value)
+	default:
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Sprint(value)
+		}
+		return string(encoded)
+	}
+}
+
+// Fields is written to JSON as an object of key and native value.
+type Fields []Field
+
+func (f Fields) MarshalJSON() ([]byte, error) {
+	values := make(map[string]interface{}, len(f))
+	for _, field := range f {
+		values[field.Key] = field.JSONValue()
+	}
+	return json.Marshal(values)
+}
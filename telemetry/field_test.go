@@ -0,0 +1,85 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFieldsMarshalJSON(t *testing.T) {
+	fields := Fields{
+		String("user", "annwyl"),
+		Int("attempts", 3),
+		Float("ratio", 0.5),
+		Bool("cached", true),
+		Duration("latency", 1500*time.Microsecond),
+		Time("at", time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)),
+		Err(errors.New("boom")),
+		Any("ids", []int{1, 2}),
+	}
+
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		t.Fatalf("marshal returned error: %v", err)
+	}
+
+	want := `{"at":"2024-05-01T10:00:00Z","attempts":3,"cached":true,"error":"boom","ids":[1,2],"latency":1.5,"ratio":0.5,"user":"annwyl"}`
+	if string(encoded) != want {
+		t.Errorf("wanted %s, got %s", want, encoded)
+	}
+}
+
+func TestFieldString(t *testing.T) {
+	tests := []struct {
+		field Field
+		want  string
+	}{
+		{String("k", "v"), "v"},
+		{Int("k", 42), "42"},
+		{Bool("k", false), "false"},
+		{Duration("k", 2*time.Second), "2s"},
+		{Err(nil), ""},
+		{Any("k", map[string]int{"a": 1}), `{"a":1}`},
+	}
+
+	for _, tt := range tests {
+		if got := tt.field.String(); got != tt.want {
+			t.Errorf("wanted %q, got %q", tt.want, got)
+		}
+	}
+}
+
+func TestTagsHelper(t *testing.T) {
+	fields := Tags(map[string]string{"b": "2", "a": "1"})
+	if len(fields) != 2 || fields[0].Key != "a" || fields[1].Value != "2" {
+		t.Errorf("unexpected fields: %v", fields)
+	}
+}
+
+func TestLogFields(t *testing.T) {
+	logger, mockDriver := newTransactionTestLogger(Config{
+		LogLevel:    DebugLevel,
+		DefaultTags: map[string]string{"environment": "test", "attempts": "none"},
+	})
+
+	err := logger.InfoFields("typed", []Field{Int("attempts", 2), Err(errors.New("timeout"))})
+	if err != nil {
+		t.Fatalf("infofields returned error: %v", err)
+	}
+
+	if len(mockDriver.logs) != 1 {
+		t.Fatalf("wanted 1 log, got %d", len(mockDriver.logs))
+	}
+
+	values := mockDriver.logs[0].Values()
+	if values["environment"] != "test" {
+		t.Errorf("wanted default tag kept, got %v", values["environment"])
+	}
+	if values["attempts"] != int64(2) {
+		t.Errorf("wanted typed field to override tag, got %v", values["attempts"])
+	}
+	if values["error"] != "timeout" {
+		t.Errorf("wanted error field, got %v", values["error"])
+	}
+}
@@ -0,0 +1,222 @@
+package telemetry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+)
+
+// Formatter turns a log into the line a driver writes, including the
+// trailing newline.
+type Formatter interface {
+	Format(log Log) ([]byte, error)
+}
+
+// FormatConfig selects a formatter, drivers that write lines embed it in
+// their driver_config. Format is "text" (logfmt), "json" or "template", in
+// which case Template is a text/template executed with the log.
+type FormatConfig struct {
+	Format     string `json:"format,omitempty"`
+	Template   string `json:"template,omitempty"`
+	TimeFormat string `json:"time_format,omitempty"`
+}
+
+// NewFormatter builds the formatter for config, defaultFormat is used when
+// no format is set.
+func NewFormatter(config FormatConfig, defaultFormat string) (Formatter, error) {
+	format := config.Format
+	if format == "" {
+		format = defaultFormat
+	}
+
+	switch format {
+	case "text", "logfmt":
+		return &TextFormatter{TimeFormat: config.TimeFormat}, nil
+	case "json":
+		return &JSONFormatter{TimeFormat: config.TimeFormat}, nil
+	case "template":
+		if config.Template == "" {
+			return nil, fmt.Errorf("template format needs a template")
+		}
+		return NewTemplateFormatter(config.Template, config.TimeFormat)
+	}
+	return nil, fmt.Errorf("unknown format %q (must be text, json or template)", format)
+}
+
+func formatTime(t time.Time, layout string) string {
+	if layout == "" {
+		layout = time.RFC3339Nano
+	}
+	return t.Format(layout)
+}
+
+// TextFormatter writes logfmt: time, level, msg and the transaction IDs,
+// followed by tags and fields sorted by key.
+type TextFormatter struct {
+	TimeFormat string
+}
+
+func (f *TextFormatter) Format(log Log) ([]byte, error) {
+	var b bytes.Buffer
+	writeLogfmt(&b, "time", formatTime(log.Timestamp, f.TimeFormat))
+	writeLogfmt(&b, "level", log.Level.String())
+	writeLogfmt(&b, "msg", log.Message)
+	if log.TransactionID != "" {
+		writeLogfmt(&b, "transaction_id", log.TransactionID)
+	}
+	if log.ParentID != "" {
+		writeLogfmt(&b, "parent_id", log.ParentID)
+	}
+	if log.TraceID != "" {
+		writeLogfmt(&b, "trace_id", log.TraceID)
+	}
+
+	values := log.StringValues()
+	for _, key := range sortedKeys(values) {
+		writeLogfmt(&b, key, values[key])
+	}
+	b.WriteByte('\n')
+	return b.Bytes(), nil
+}
+
+func writeLogfmt(b *bytes.Buffer, key, value string) {
+	if b.Len() > 0 {
+		b.WriteByte(' ')
+	}
+	b.WriteString(key)
+	b.WriteByte('=')
+	if needsQuoting(value) {
+		b.WriteString(strconv.Quote(value))
+	} else {
+		b.WriteString(value)
+	}
+}
+
+func needsQuoting(value string) bool {
+	if value == "" {
+		return true
+	}
+	for _, r := range value {
+		if r == '=' || r == '"' || unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// StringValues merges tags and fields like Values, with fields formatted
+// for text output.
+func (l Log) StringValues() map[string]string {
+	values := make(map[string]string, len(l.Tags)+len(l.Fields))
+	for key, value := range l.Tags {
+		values[key] = value
+	}
+	for _, field := range l.Fields {
+		values[field.Key] = field.String()
+	}
+	return values
+}
+
+// JSONFormatter writes one object per line, with tags and fields under
+// "tags" like the Elasticsearch documents.
+type JSONFormatter struct {
+	TimeFormat string
+}
+
+type jsonLog struct {
+	Timestamp     string                 `json:"timestamp"`
+	Level         string                 `json:"level"`
+	Message       string                 `json:"message"`
+	Tags          map[string]interface{} `json:"tags,omitempty"`
+	TransactionID string                 `json:"transaction_id,omitempty"`
+	ParentID      string                 `json:"parent_id,omitempty"`
+	TraceID       string                 `json:"trace_id,omitempty"`
+	SpanID        string                 `json:"span_id,omitempty"`
+}
+
+func (f *JSONFormatter) Format(log Log) ([]byte, error) {
+	data, err := json.Marshal(jsonLog{
+		Timestamp:     formatTime(log.Timestamp, f.TimeFormat),
+		Level:         log.Level.String(),
+		Message:       log.Message,
+		Tags:          log.Values(),
+		TransactionID: log.TransactionID,
+		ParentID:      log.ParentID,
+		TraceID:       log.TraceID,
+		SpanID:        log.SpanID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// TemplateFormatter executes a text/template for every log. The template
+// sees the Log fields and these functions:
+//
+//	level    the level name, {{level .Level}}
+//	time     the timestamp in the configured format, {{time .Timestamp}}
+//	values   tags and fields as strings, {{range $k, $v := values .}}
+//	logfmt   tags and fields as key=value pairs, {{logfmt .}}
+//	json     any value as JSON, {{json .Tags}}
+//
+// A newline is added when the output doesn't end with one.
+type TemplateFormatter struct {
+	template *template.Template
+}
+
+func NewTemplateFormatter(text, timeFormat string) (*TemplateFormatter, error) {
+	funcs := template.FuncMap{
+		"level": LogLevel.String,
+		"time": func(t time.Time) string {
+			return formatTime(t, timeFormat)
+		},
+		"values": func(log Log) map[string]string {
+			return log.StringValues()
+		},
+		"logfmt": func(log Log) string {
+			var b bytes.Buffer
+			values := log.StringValues()
+			for _, key := range sortedKeys(values) {
+				writeLogfmt(&b, key, values[key])
+			}
+			return b.String()
+		},
+		"json": func(value interface{}) (string, error) {
+			data, err := json.Marshal(value)
+			return string(data), err
+		},
+	}
+
+	tmpl, err := template.New("log").Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log template: %v", err)
+	}
+	return &TemplateFormatter{template: tmpl}, nil
+}
+
+func (f *TemplateFormatter) Format(log Log) ([]byte, error) {
+	var b bytes.Buffer
+	if err := f.template.Execute(&b, log); err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(b.String(), "\n") {
+		b.WriteByte('\n')
+	}
+	return b.Bytes(), nil
+}
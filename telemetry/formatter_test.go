@@ -0,0 +1,92 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+var formatterTestLog = Log{
+	Timestamp:     time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC),
+	Level:         WarningLevel,
+	Message:       "cache miss",
+	Tags:          map[string]string{"region": "eu west", "app": "api"},
+	Fields:        Fields{Int("attempt", 2), Duration("took", 1500*time.Millisecond)},
+	TransactionID: "abc",
+}
+
+func TestTextFormatter(t *testing.T) {
+	formatter, err := NewFormatter(FormatConfig{}, "text")
+	if err != nil {
+		t.Fatalf("newformatter returned error: %v", err)
+	}
+
+	line, err := formatter.Format(formatterTestLog)
+	if err != nil {
+		t.Fatalf("format returned error: %v", err)
+	}
+	want := `time=2024-03-01T12:30:00Z level=warning msg="cache miss" transaction_id=abc app=api attempt=2 region="eu west" took=1.5s` + "\n"
+	if string(line) != want {
+		t.Errorf("unexpected line\nwant %s got  %s", want, line)
+	}
+}
+
+func TestJSONFormatter(t *testing.T) {
+	formatter, err := NewFormatter(FormatConfig{Format: "json", TimeFormat: time.DateOnly}, "text")
+	if err != nil {
+		t.Fatalf("newformatter returned error: %v", err)
+	}
+
+	line, err := formatter.Format(formatterTestLog)
+	if err != nil {
+		t.Fatalf("format returned error: %v", err)
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(line, &decoded); err != nil {
+		t.Fatalf("invalid json %s: %v", line, err)
+	}
+	tags := decoded["tags"].(map[string]interface{})
+	if decoded["timestamp"] != "2024-03-01" || decoded["level"] != "warning" || decoded["message"] != "cache miss" || decoded["transaction_id"] != "abc" {
+		t.Errorf("unexpected json %s", line)
+	}
+	if tags["attempt"] != 2.0 || tags["took"] != 1500.0 || tags["region"] != "eu west" {
+		t.Errorf("unexpected tags %v", tags)
+	}
+	if _, ok := decoded["parent_id"]; ok {
+		t.Error("empty IDs should be left out")
+	}
+}
+
+func TestTemplateFormatter(t *testing.T) {
+	formatter, err := NewFormatter(FormatConfig{
+		Format:     "template",
+		Template:   `{{time .Timestamp}} [{{level .Level}}] {{.Message}} {{logfmt .}}`,
+		TimeFormat: time.Kitchen,
+	}, "text")
+	if err != nil {
+		t.Fatalf("newformatter returned error: %v", err)
+	}
+
+	line, err := formatter.Format(formatterTestLog)
+	if err != nil {
+		t.Fatalf("format returned error: %v", err)
+	}
+	want := `12:30PM [warning] cache miss app=api attempt=2 region="eu west" took=1.5s` + "\n"
+	if string(line) != want {
+		t.Errorf("unexpected line\nwant %s got  %s", want, line)
+	}
+}
+
+func TestNewFormatterErrors(t *testing.T) {
+	tests := []FormatConfig{
+		{Format: "xml"},
+		{Format: "template"},
+		{Format: "template", Template: "{{.Message"},
+	}
+	for _, config := range tests {
+		if _, err := NewFormatter(config, "text"); err == nil {
+			t.Errorf("wanted error for %+v", config)
+		}
+	}
+}
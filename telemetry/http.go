@@ -0,0 +1,197 @@
+package telemetry
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// Middleware starts a transaction for every request, continuing the trace
+// from incoming headers, and puts it in the request context. When the
+// handler is done it logs an access line, 5xx at error and 4xx at warning
+// level, and ends the transaction. Panics are recovered, logged at error
+// level and answered with a 500.
+func (l *Logger) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		transactionID := l.StartTransactionFromHeaders(r.Header)
+		ctx := ContextWithTransaction(r.Context(), transactionID)
+		recorder := &responseRecorder{ResponseWriter: w}
+		start := time.Now()
+
+		defer func() {
+			recovered := recover()
+			if recovered == http.ErrAbortHandler {
+				l.EndTransactionWithTags(transactionID, map[string]string{"outcome": "aborted"})
+				panic(recovered)
+			}
+			if recovered != nil {
+				if !recorder.wroteHeader {
+					recorder.WriteHeader(http.StatusInternalServerError)
+				}
+				l.logPanic(recovered, transactionID)
+			}
+
+			status := recorder.statusCode()
+			fields := []Field{
+				String("method", r.Method),
+				String("path", r.URL.Path),
+				Int("status", status),
+				Int64("bytes", recorder.bytes),
+				Duration("latency", time.Since(start)),
+				String("remote_addr", r.RemoteAddr),
+			}
+			if err := l.log(statusLevel(status), "request", nil, fields, transactionID); err != nil {
+				l.handleError(err)
+			}
+
+			outcome := "success"
+			if recovered != nil || status >= 500 {
+				outcome = "failure"
+			}
+			if err := l.EndTransactionWithTags(transactionID, map[string]string{"outcome": outcome}); err != nil {
+				l.handleError(err)
+			}
+		}()
+
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+	})
+}
+
+func (l *Logger) logPanic(recovered interface{}, transactionID string) {
+	fields := []Field{
+		String("panic", fmt.Sprint(recovered)),
+		String("stack", string(debug.Stack())),
+	}
+	if err := l.log(ErrorLevel, "panic recovered", nil, fields, transactionID); err != nil {
+		l.handleError(err)
+	}
+}
+
+func statusLevel(status int) LogLevel {
+	switch {
+	case status >= 500:
+		return ErrorLevel
+	case status >= 400:
+		return WarningLevel
+	default:
+		return InfoLevel
+	}
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *responseRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack lets handlers like WebSocket servers take over the connection. The
+// response counts as written, with status 101 unless one was set before.
+func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !r.wroteHeader {
+		r.status = http.StatusSwitchingProtocols
+		r.wroteHeader = true
+	}
+	return conn, rw, nil
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func (r *responseRecorder) statusCode() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// RoundTripper wraps next, http.DefaultTransport if nil, so every outgoing
+// request runs in its own transaction nested inside the one in the request
+// context. Trace headers are added to the request and a line with the
+// method, URL, status and latency is logged.
+func (l *Logger) RoundTripper(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		transactionID := l.StartTransaction(TransactionFromContext(req.Context()))
+
+		// a RoundTripper must not modify the caller's request
+		outgoing := req.Clone(ContextWithTransaction(req.Context(), transactionID))
+		if err := l.InjectHeaders(transactionID, outgoing.Header); err != nil {
+			l.handleError(err)
+		}
+
+		start := time.Now()
+		resp, err := next.RoundTrip(outgoing)
+
+		fields := []Field{
+			String("method", req.Method),
+			String("url", req.URL.Redacted()),
+			Duration("latency", time.Since(start)),
+		}
+		level, outcome := InfoLevel, "success"
+		if err != nil {
+			fields = append(fields, Err(err))
+			level, outcome = ErrorLevel, "failure"
+		} else {
+			fields = append(fields, Int("status", resp.StatusCode))
+			level = statusLevel(resp.StatusCode)
+			if resp.StatusCode >= 500 {
+				outcome = "failure"
+			}
+		}
+
+		if logErr := l.log(level, "outgoing request", nil, fields, transactionID); logErr != nil {
+			l.handleError(logErr)
+		}
+		if endErr := l.EndTransactionWithTags(transactionID, map[string]string{"outcome": outcome}); endErr != nil {
+			l.handleError(endErr)
+		}
+
+		return resp, err
+	})
+}
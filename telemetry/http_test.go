@@ -0,0 +1,172 @@
+package telemetry
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func findLog(logs []Log, message string) (Log, bool) {
+	for _, log := range logs {
+		if log.Message == message {
+			return log, true
+		}
+	}
+	return Log{}, false
+}
+
+func TestMiddleware(t *testing.T) {
+	logger, mockDriver := newTransactionTestLogger(Config{LogLevel: DebugLevel})
+
+	var seen string
+	handler := logger.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = TransactionFromContext(r.Context())
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("missing"))
+	}))
+
+	req := httptest.NewRequest("GET", "/things/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if seen != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("wanted handler to see the transaction continued from headers, got %s", seen)
+	}
+
+	access, ok := findLog(mockDriver.logs, "request")
+	if !ok {
+		t.Fatalf("wanted access log, got %v", mockDriver.logs)
+	}
+	values := access.Values()
+	if access.Level != WarningLevel || values["status"] != int64(404) || values["bytes"] != int64(7) || values["path"] != "/things/1" || values["method"] != "GET" {
+		t.Errorf("unexpected access log %+v", values)
+	}
+	if _, ok := values["remote_addr"]; !ok {
+		t.Error("wanted remote_addr in access log")
+	}
+
+	if logger.OpenTransactions() != 0 {
+		t.Error("wanted transaction ended")
+	}
+}
+
+func TestMiddlewarePanic(t *testing.T) {
+	logger, mockDriver := newTransactionTestLogger(Config{LogLevel: DebugLevel})
+
+	handler := logger.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("kaboom")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("wanted 500 after panic, got %d", rec.Code)
+	}
+
+	panicLog, ok := findLog(mockDriver.logs, "panic recovered")
+	if !ok || panicLog.Level != ErrorLevel || panicLog.Values()["panic"] != "kaboom" {
+		t.Errorf("wanted panic logged at error level, got %v", mockDriver.logs)
+	}
+
+	summary, ok := findLog(mockDriver.logs, "transaction finished")
+	if !ok || summary.Tags["outcome"] != "failure" {
+		t.Errorf("wanted failed transaction summary, got %v", summary)
+	}
+}
+
+func TestMiddlewareHijack(t *testing.T) {
+	logger, mockDriver := newTransactionTestLogger(Config{LogLevel: DebugLevel})
+
+	done := make(chan struct{})
+	handler := logger.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hijacker, ok := w.(http.Hijacker)
+		if !ok {
+			t.Error("wanted the response writer to be a hijacker")
+			return
+		}
+		conn, rw, err := hijacker.Hijack()
+		if err != nil {
+			t.Errorf("hijack returned error: %v", err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		rw.Flush()
+	}))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "GET /socket HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("failed to read upgrade response: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("wanted 101, got %d", resp.StatusCode)
+	}
+	<-done
+
+	mockDriver.mu.Lock()
+	defer mockDriver.mu.Unlock()
+	access, ok := findLog(mockDriver.logs, "request")
+	if !ok || access.Values()["status"] != int64(http.StatusSwitchingProtocols) {
+		t.Errorf("wanted access log with status 101, got %v", mockDriver.logs)
+	}
+
+	recorder := &responseRecorder{ResponseWriter: httptest.NewRecorder()}
+	if _, _, err := recorder.Hijack(); err != http.ErrNotSupported {
+		t.Errorf("wanted errnotsupported from a writer that can't hijack, got %v", err)
+	}
+}
+
+func TestRoundTripper(t *testing.T) {
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	logger, mockDriver := newTransactionTestLogger(Config{LogLevel: DebugLevel})
+	ctx, parent := logger.StartTransactionContext(context.Background())
+
+	client := &http.Client{Transport: logger.RoundTripper(nil)}
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/health", nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request returned error: %v", err)
+	}
+	resp.Body.Close()
+
+	if traceparent == "" {
+		t.Error("wanted traceparent on outgoing request")
+	}
+	if req.Header.Get("traceparent") != "" {
+		t.Error("the caller's request shouldn't be modified")
+	}
+
+	outgoing, ok := findLog(mockDriver.logs, "outgoing request")
+	if !ok || outgoing.Level != ErrorLevel || outgoing.Values()["status"] != int64(503) {
+		t.Fatalf("wanted outgoing request logged at error level, got %v", mockDriver.logs)
+	}
+	if outgoing.ParentID != parent || outgoing.TraceID != parent {
+		t.Errorf("wanted outgoing request nested in %s, got parent %s", parent, outgoing.ParentID)
+	}
+	if logger.OpenTransactions() != 1 {
+		t.Errorf("wanted only the parent transaction open, got %d", logger.OpenTransactions())
+	}
+}
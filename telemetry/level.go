@@ -0,0 +1,98 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type LogLevel int
+
+// The levels up to ErrorLevel keep their old numbers, so configs that give
+// log_level as a number still work.
+const (
+	TraceLevel LogLevel = iota - 1
+	DebugLevel
+	InfoLevel
+	WarningLevel
+	ErrorLevel
+	PanicLevel
+	FatalLevel
+)
+
+// exit is replaced in tests of Fatal.
+var exit = os.Exit
+
+var levelNames = map[LogLevel]string{
+	TraceLevel:   "trace",
+	DebugLevel:   "debug",
+	InfoLevel:    "info",
+	WarningLevel: "warning",
+	ErrorLevel:   "error",
+	PanicLevel:   "panic",
+	FatalLevel:   "fatal",
+}
+
+func (l LogLevel) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+func (l LogLevel) valid() bool {
+	return l >= TraceLevel && l <= FatalLevel
+}
+
+// ParseLevel reads a level name, case insensitive and with "warn" as an
+// alias of "warning", or the level number.
+func ParseLevel(text string) (LogLevel, error) {
+	name := strings.ToLower(strings.TrimSpace(text))
+	if name == "warn" {
+		return WarningLevel, nil
+	}
+	for level, levelName := range levelNames {
+		if name == levelName {
+			return level, nil
+		}
+	}
+
+	if number, err := strconv.Atoi(name); err == nil && LogLevel(number).valid() {
+		return LogLevel(number), nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", text)
+}
+
+func (l LogLevel) MarshalText() ([]byte, error) {
+	if !l.valid() {
+		return nil, fmt.Errorf("invalid log level: %d", int(l))
+	}
+	return []byte(l.String()), nil
+}
+
+func (l *LogLevel) UnmarshalText(text []byte) error {
+	level, err := ParseLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*l = level
+	return nil
+}
+
+// UnmarshalJSON takes a level name or, like older configs, a number. Numbers
+// aren't range checked here, validateConfig reports those.
+func (l *LogLevel) UnmarshalJSON(data []byte) error {
+	var number int
+	if err := json.Unmarshal(data, &number); err == nil {
+		*l = LogLevel(number)
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("log level must be a name or a number: %s", data)
+	}
+	return l.UnmarshalText([]byte(text))
+}
@@ -0,0 +1,132 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := map[string]LogLevel{
+		"trace":   TraceLevel,
+		"DEBUG":   DebugLevel,
+		" info ":  InfoLevel,
+		"warn":    WarningLevel,
+		"warning": WarningLevel,
+		"error":   ErrorLevel,
+		"panic":   PanicLevel,
+		"fatal":   FatalLevel,
+		"2":       WarningLevel,
+	}
+	for text, want := range tests {
+		level, err := ParseLevel(text)
+		if err != nil || level != want {
+			t.Errorf("%q: wanted %v, got %v %v", text, want, level, err)
+		}
+	}
+
+	for _, text := range []string{"verbose", "9", ""} {
+		if _, err := ParseLevel(text); err == nil {
+			t.Errorf("%q: wanted error", text)
+		}
+	}
+}
+
+func TestLogLevelJSON(t *testing.T) {
+	var config struct {
+		Named  LogLevel `json:"named"`
+		Number LogLevel `json:"number"`
+	}
+	if err := json.Unmarshal([]byte(`{"named":"warning","number":1}`), &config); err != nil {
+		t.Fatalf("unmarshal returned error: %v", err)
+	}
+	if config.Named != WarningLevel || config.Number != InfoLevel {
+		t.Errorf("unexpected levels %v %v", config.Named, config.Number)
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		t.Fatalf("marshal returned error: %v", err)
+	}
+	if string(data) != `{"named":"warning","number":"info"}` {
+		t.Errorf("wanted level names in json, got %s", data)
+	}
+
+	if err := json.Unmarshal([]byte(`{"named":"loud"}`), &config); err == nil {
+		t.Error("wanted error for unknown level name")
+	}
+	if _, err := json.Marshal(LogLevel(42)); err == nil {
+		t.Error("wanted error marshalling an invalid level")
+	}
+	if LogLevel(42).String() != "level(42)" {
+		t.Errorf("unexpected name %s", LogLevel(42))
+	}
+}
+
+type closeRecordingDriver struct {
+	MockDriver
+	closed bool
+}
+
+func (c *closeRecordingDriver) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestFatal(t *testing.T) {
+	driver := &closeRecordingDriver{}
+	logger := newBufferedLogger(driver, BufferConfig{FlushInterval: JSONDuration(time.Hour)})
+
+	code := -1
+	exit = func(c int) { code = c }
+	defer func() { exit = os.Exit }()
+
+	logger.Fatal("out of disk", nil)
+
+	if code != 1 {
+		t.Errorf("wanted exit status 1, got %d", code)
+	}
+	if len(driver.logs) != 1 || driver.logs[0].Level != FatalLevel {
+		t.Errorf("wanted the fatal entry flushed before exiting, got %v", driver.logs)
+	}
+	if !driver.closed {
+		t.Error("wanted driver closed before exiting")
+	}
+}
+
+func TestFatalChild(t *testing.T) {
+	driver := &closeRecordingDriver{}
+	logger := newBufferedLogger(driver, BufferConfig{FlushInterval: JSONDuration(time.Hour)})
+
+	code := -1
+	exit = func(c int) { code = c }
+	defer func() { exit = os.Exit }()
+
+	logger.Info("queued", nil)
+	logger.Named("db").Fatal("out of connections", nil)
+
+	if code != 1 {
+		t.Errorf("wanted exit status 1, got %d", code)
+	}
+	if len(driver.logs) != 2 || driver.logs[1].Level != FatalLevel {
+		t.Errorf("wanted the queued and fatal entries flushed before exiting, got %v", driver.logs)
+	}
+	if !driver.closed {
+		t.Error("wanted driver closed before exiting")
+	}
+}
+
+func TestPanic(t *testing.T) {
+	logger, mockDriver := newTransactionTestLogger(Config{LogLevel: InfoLevel})
+
+	defer func() {
+		if recovered := recover(); recovered != "broken invariant" {
+			t.Errorf("wanted panic with the message, got %v", recovered)
+		}
+		if len(mockDriver.logs) != 1 || mockDriver.logs[0].Level != PanicLevel {
+			t.Errorf("wanted panic entry logged, got %v", mockDriver.logs)
+		}
+	}()
+	logger.Panic("broken invariant", nil)
+}
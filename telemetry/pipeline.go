@@ -0,0 +1,187 @@
+package telemetry
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type OverflowPolicy string
+
+const (
+	OverflowBlock      OverflowPolicy = "block"
+	OverflowDropNewest OverflowPolicy = "drop_newest"
+	OverflowDropOldest OverflowPolicy = "drop_oldest"
+)
+
+const (
+	defaultQueueSize     = 1024
+	defaultFlushInterval = time.Second
+)
+
+var errLoggerClosed = errors.New("logger is closed")
+
+// BufferConfig turns on the asynchronous pipeline. Entries are queued and
+// handed to the driver by a background flusher every FlushInterval, or as
+// soon as the queue fills up.
+type BufferConfig struct {
+	QueueSize     int            `json:"queue_size"`
+	FlushInterval JSONDuration   `json:"flush_interval"`
+	Overflow      OverflowPolicy `json:"overflow" jsonschema:"enum=block|drop_newest|drop_oldest"`
+}
+
+// Flusher can be implemented by drivers that buffer internally, the
+// pipeline calls Flush after every batch it hands over.
+type Flusher interface {
+	Flush() error
+}
+
+type pipeline struct {
+	mutex    sync.Mutex
+	notFull  *sync.Cond
+	queue    []Log
+	size     int
+	policy   OverflowPolicy
+	interval time.Duration
+	closed   bool
+	dropped  int
+	write    func(batch []Log, dropped int)
+	wake     chan struct{}
+	done     chan struct{}
+}
+
+func newPipeline(config BufferConfig, write func(batch []Log, dropped int)) *pipeline {
+	p := &pipeline{
+		size:     config.QueueSize,
+		policy:   config.Overflow,
+		interval: time.Duration(config.FlushInterval),
+		write:    write,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	if p.size <= 0 {
+		p.size = defaultQueueSize
+	}
+	if p.interval <= 0 {
+		p.interval = defaultFlushInterval
+	}
+	if p.policy == "" {
+		p.policy = OverflowBlock
+	}
+	p.queue = make([]Log, 0, p.size)
+	p.notFull = sync.NewCond(&p.mutex)
+
+	go p.run()
+	return p
+}
+
+func (p *pipeline) enqueue(log Log) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for !p.closed && len(p.queue) >= p.size {
+		switch p.policy {
+		case OverflowDropNewest:
+			p.dropped++
+			return nil
+		case OverflowDropOldest:
+			copy(p.queue, p.queue[1:])
+			p.queue = p.queue[:len(p.queue)-1]
+			p.dropped++
+		default:
+			p.signal()
+			p.notFull.Wait()
+		}
+	}
+
+	if p.closed {
+		return errLoggerClosed
+	}
+
+	p.queue = append(p.queue, log)
+	if len(p.queue) >= p.size {
+		p.signal()
+	}
+	return nil
+}
+
+func (p *pipeline) signal() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (p *pipeline) take() ([]Log, int, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	batch := p.queue
+	dropped := p.dropped
+	p.queue = make([]Log, 0, p.size)
+	p.dropped = 0
+	p.notFull.Broadcast()
+
+	return batch, dropped, p.closed
+}
+
+func (p *pipeline) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-p.wake:
+		}
+
+		batch, dropped, closed := p.take()
+		if len(batch) > 0 || dropped > 0 {
+			p.write(batch, dropped)
+		}
+		if closed {
+			return
+		}
+	}
+}
+
+// close stops accepting entries and waits until the flusher has handed
+// everything that is still queued to the driver.
+func (p *pipeline) close() {
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		<-p.done
+		return
+	}
+	p.closed = true
+	p.notFull.Broadcast()
+	p.mutex.Unlock()
+
+	p.signal()
+	<-p.done
+}
+
+func (l *Logger) writeBatch(batch []Log, dropped int) {
+	l.swapMutex.RLock()
+	defer l.swapMutex.RUnlock()
+
+	for _, log := range batch {
+		if err := l.driver.Log(log); err != nil {
+			l.handleError(err)
+		}
+	}
+
+	if flusher, ok := l.driver.(Flusher); ok {
+		if err := flusher.Flush(); err != nil {
+			l.handleError(err)
+		}
+	}
+
+	if dropped > 0 {
+		l.handleError(fmt.Errorf("queue full, dropped %d log entries", dropped))
+	}
+}
@@ -0,0 +1,160 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+)
+
+type SlowDriver struct {
+	MockDriver
+	delay   time.Duration
+	flushes int
+}
+
+func (s *SlowDriver) Log(log Log) error {
+	time.Sleep(s.delay)
+	return s.MockDriver.Log(log)
+}
+
+func (s *SlowDriver) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushes++
+	return nil
+}
+
+func (s *SlowDriver) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.logs)
+}
+
+func newBufferedLogger(driver Driver, buffer BufferConfig) *Logger {
+	logger, _ := newTransactionTestLogger(Config{LogLevel: DebugLevel})
+	logger.driver = driver
+	logger.pipeline = newPipeline(buffer, logger.writeBatch)
+	return logger
+}
+
+func TestBufferedLoggingDoesNotBlock(t *testing.T) {
+	driver := &SlowDriver{delay: 50 * time.Millisecond}
+	logger := newBufferedLogger(driver, BufferConfig{QueueSize: 100, FlushInterval: JSONDuration(time.Hour)})
+
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		if err := logger.Info("buffered", nil); err != nil {
+			t.Fatalf("info returned error: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("logging took %v, should return right away", elapsed)
+	}
+
+	if err := logger.Close(); err != nil {
+		t.Fatalf("close returned error: %v", err)
+	}
+
+	if driver.count() != 10 {
+		t.Errorf("wanted 10 logs after close, got %d", driver.count())
+	}
+	if driver.flushes == 0 {
+		t.Error("wanted driver to be flushed")
+	}
+}
+
+func TestBufferedFlushInterval(t *testing.T) {
+	driver := &SlowDriver{}
+	logger := newBufferedLogger(driver, BufferConfig{QueueSize: 100, FlushInterval: JSONDuration(10 * time.Millisecond)})
+	defer logger.Close()
+
+	logger.Info("tick", nil)
+
+	deadline := time.Now().Add(time.Second)
+	for driver.count() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if driver.count() != 1 {
+		t.Errorf("wanted entry flushed by interval, got %d logs", driver.count())
+	}
+}
+
+func TestBufferedOverflowPolicies(t *testing.T) {
+	tests := []struct {
+		policy  OverflowPolicy
+		wantLen int
+		first   string
+	}{
+		{OverflowDropNewest, 2, "0"},
+		{OverflowDropOldest, 2, "2"},
+	}
+
+	for _, tt := range tests {
+		// no flusher is running, so the queue really overflows
+		p := &pipeline{size: 2, policy: tt.policy, wake: make(chan struct{}, 1)}
+		p.notFull = sync.NewCond(&p.mutex)
+
+		for _, msg := range []string{"0", "1", "2", "3"} {
+			if err := p.enqueue(Log{Message: msg}); err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.policy, err)
+			}
+		}
+
+		if len(p.queue) != tt.wantLen {
+			t.Errorf("%s: wanted %d queued, got %d", tt.policy, tt.wantLen, len(p.queue))
+		}
+		if len(p.queue) > 0 && p.queue[0].Message != tt.first {
+			t.Errorf("%s: wanted first entry %s, got %s", tt.policy, tt.first, p.queue[0].Message)
+		}
+		if p.dropped != 2 {
+			t.Errorf("%s: wanted 2 dropped, got %d", tt.policy, p.dropped)
+		}
+	}
+}
+
+func TestBufferedBlockPolicy(t *testing.T) {
+	driver := &SlowDriver{}
+	logger := newBufferedLogger(driver, BufferConfig{QueueSize: 2, FlushInterval: JSONDuration(time.Hour), Overflow: OverflowBlock})
+
+	for i := 0; i < 10; i++ {
+		if err := logger.Info("block", nil); err != nil {
+			t.Fatalf("info returned error: %v", err)
+		}
+	}
+
+	logger.Close()
+	if driver.count() != 10 {
+		t.Errorf("wanted no entries lost with block policy, got %d", driver.count())
+	}
+}
+
+func TestLogAfterClose(t *testing.T) {
+	logger := newBufferedLogger(&SlowDriver{}, BufferConfig{})
+	logger.Close()
+
+	if err := logger.Info("too late", nil); err == nil {
+		t.Error("wanted error logging to a closed logger")
+	}
+}
+
+func TestBufferConfig(t *testing.T) {
+	var config Config
+	err := json.Unmarshal([]byte(`{
+		"driver": "console",
+		"driver_config": "",
+		"buffer": {"queue_size": 10, "flush_interval": "250ms", "overflow": "drop_oldest"}
+	}`), &config)
+	if err != nil {
+		t.Fatalf("unmarshal returned error: %v", err)
+	}
+
+	if time.Duration(config.Buffer.FlushInterval) != 250*time.Millisecond {
+		t.Errorf("wanted flush interval 250ms, got %v", time.Duration(config.Buffer.FlushInterval))
+	}
+
+	config.Buffer.Overflow = "sometimes"
+	if err := validateConfig(config); err == nil {
+		t.Error("wanted error for invalid overflow policy")
+	}
+}
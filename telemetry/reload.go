@@ -0,0 +1,194 @@
+package telemetry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+)
+
+const defaultWatchInterval = 2 * time.Second
+
+// Option configures a Logger in NewLogger.
+type Option func(*Logger) error
+
+// WatchConfig reloads the config from filename when the file changes, which
+// is checked every interval, or when the process receives SIGHUP. Reloads
+// go through ApplyConfig, rejected ones are reported to the error handler.
+// The file is loaded with LoadConfig, so the environment and overrides are
+// applied on every reload.
+func WatchConfig(filename string, interval time.Duration, overrides ...func(*Config)) Option {
+	return func(l *Logger) error {
+		if interval <= 0 {
+			interval = defaultWatchInterval
+		}
+
+		info, err := os.Stat(filename)
+		if err != nil {
+			return fmt.Errorf("failed to watch config file: %v", err)
+		}
+
+		l.watcher = &watcher{
+			stop:    make(chan struct{}),
+			done:    make(chan struct{}),
+			signals: make(chan os.Signal, 1),
+		}
+		signal.Notify(l.watcher.signals, syscall.SIGHUP)
+
+		go l.watch(filename, interval, info, overrides)
+		return nil
+	}
+}
+
+type watcher struct {
+	stop    chan struct{}
+	done    chan struct{}
+	signals chan os.Signal
+}
+
+func (l *Logger) watch(filename string, interval time.Duration, last os.FileInfo, overrides []func(*Config)) {
+	defer close(l.watcher.done)
+	defer signal.Stop(l.watcher.signals)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			info, err := os.Stat(filename)
+			if err != nil {
+				// editors often replace the file, it will be back soon
+				continue
+			}
+			if last != nil && info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size() {
+				continue
+			}
+			last = info
+			l.reloadFile(filename, overrides)
+		case <-l.watcher.signals:
+			l.reloadFile(filename, overrides)
+		case <-l.watcher.stop:
+			return
+		}
+	}
+}
+
+func (l *Logger) stopWatcher() {
+	if l.watcher == nil {
+		return
+	}
+	select {
+	case <-l.watcher.stop:
+	default:
+		close(l.watcher.stop)
+	}
+	<-l.watcher.done
+}
+
+func (l *Logger) reloadFile(filename string, overrides []func(*Config)) {
+	config, err := LoadConfig(filename, overrides...)
+	if err != nil {
+		l.handleError(fmt.Errorf("config reload rejected: %v", err))
+		return
+	}
+	if err := l.ApplyConfig(config); err != nil {
+		l.handleError(err)
+	}
+}
+
+// ApplyConfig replaces the config of a running logger. The new config is
+// validated first and, when it is rejected, the old one stays in place.
+// Levels, tags and transaction settings change at once for every following
+// entry. When the driver, its config or the retry settings change a new
+// driver is created, and the old one is closed once the writes in flight
+// are done. Buffer settings can't be changed without a restart.
+func (l *Logger) ApplyConfig(config Config) error {
+	l = l.root()
+	l.reloadMutex.Lock()
+	defer l.reloadMutex.Unlock()
+
+	if l.closed {
+		return fmt.Errorf("config reload rejected: %v", errLoggerClosed)
+	}
+
+	if err := validateConfig(config); err != nil {
+		return fmt.Errorf("config reload rejected: %v", err)
+	}
+
+	l.mutex.Lock()
+	current := l.config
+	l.mutex.Unlock()
+
+	if !reflect.DeepEqual(current.Buffer, config.Buffer) {
+		return fmt.Errorf("config reload rejected: buffer settings can't change without a restart")
+	}
+
+	var driver Driver
+	driverChanged := driverConfigChanged(current, config)
+	if driverChanged {
+		var err error
+		driver, err = getDriver(config)
+		if err != nil {
+			return fmt.Errorf("config reload rejected: %v", err)
+		}
+	}
+
+	defaultTags := make(map[string]string, len(config.DefaultTags))
+	for k, v := range config.DefaultTags {
+		defaultTags[k] = v
+	}
+	config.DefaultTags = defaultTags
+
+	// the flusher holds swapMutex while it writes a batch and direct writes
+	// hold the mutex, so nothing uses the old driver once both are taken
+	l.swapMutex.Lock()
+	l.mutex.Lock()
+	old := l.driver
+	if driverChanged {
+		l.driver = driver
+	}
+	l.config = config
+	l.mutex.Unlock()
+	l.swapMutex.Unlock()
+
+	if driverChanged {
+		if err := old.Close(); err != nil {
+			l.handleError(fmt.Errorf("failed to close old driver: %v", err))
+		}
+	}
+
+	if !reflect.DeepEqual(current.Sampling, config.Sampling) {
+		l.stopSampler()
+		if config.Sampling != nil {
+			l.startSampler(*config.Sampling)
+		}
+	}
+
+	if current.Transactions.MaxAge != config.Transactions.MaxAge || current.Transactions.ReapInterval != config.Transactions.ReapInterval {
+		l.stopReaper()
+		l.reaper = nil
+		if config.Transactions.MaxAge > 0 {
+			l.startReaper()
+		}
+	}
+
+	return nil
+}
+
+func driverConfigChanged(current, config Config) bool {
+	if current.Name != config.Name || !reflect.DeepEqual(current.Retry, config.Retry) {
+		return true
+	}
+
+	// formatting of the raw driver config doesn't matter
+	var a, b bytes.Buffer
+	if json.Compact(&a, current.Config) != nil || json.Compact(&b, config.Config) != nil {
+		return !bytes.Equal(current.Config, config.Config)
+	}
+	return !bytes.Equal(a.Bytes(), b.Bytes())
+}
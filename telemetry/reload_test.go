@@ -0,0 +1,244 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// reloadDrivers keeps the drivers created by the "reloadMock" driver, keyed
+// by the name in their driver_config.
+var reloadDrivers = struct {
+	sync.Mutex
+	byName map[string]*closeRecordingDriver
+}{byName: make(map[string]*closeRecordingDriver)}
+
+func registerReloadDriver() {
+	// registered once for all tests, RegisterDriver refuses duplicates
+	RegisterDriver("reloadMock", func(config json.RawMessage) (Driver, error) {
+		var cfg struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(config, &cfg); err != nil {
+			return nil, err
+		}
+		driver := &closeRecordingDriver{}
+		reloadDrivers.Lock()
+		reloadDrivers.byName[cfg.Name] = driver
+		reloadDrivers.Unlock()
+		return driver, nil
+	})
+}
+
+func reloadDriver(name string) *closeRecordingDriver {
+	reloadDrivers.Lock()
+	defer reloadDrivers.Unlock()
+	return reloadDrivers.byName[name]
+}
+
+func TestApplyConfig(t *testing.T) {
+	registerReloadDriver()
+
+	config := Config{Name: "reloadMock", Config: json.RawMessage(`{"name": "apply-first"}`), LogLevel: InfoLevel}
+	logger, err := NewLogger(config)
+	if err != nil {
+		t.Fatalf("newlogger returned error: %v", err)
+	}
+	defer logger.Close()
+	first := reloadDriver("apply-first")
+
+	config.LogLevel = DebugLevel
+	config.DefaultTags = map[string]string{"version": "2"}
+	config.Config = json.RawMessage(`{"name":"apply-first"}`)
+	if err := logger.ApplyConfig(config); err != nil {
+		t.Fatalf("applyconfig returned error: %v", err)
+	}
+	logger.Debug("after level change", nil)
+	if len(first.logs) != 1 || first.logs[0].Tags["version"] != "2" {
+		t.Fatalf("wanted new level and tags on the same driver, got %v", first.logs)
+	}
+
+	config.Config = json.RawMessage(`{"name": "apply-second"}`)
+	if err := logger.ApplyConfig(config); err != nil {
+		t.Fatalf("applyconfig returned error: %v", err)
+	}
+	second := reloadDriver("apply-second")
+	logger.Info("after driver change", nil)
+
+	if !first.closed {
+		t.Error("wanted old driver closed")
+	}
+	if len(second.logs) != 1 || len(first.logs) != 1 {
+		t.Errorf("wanted entries on the new driver only, got %d and %d", len(first.logs), len(second.logs))
+	}
+}
+
+func TestApplyConfigWhileClosing(t *testing.T) {
+	registerReloadDriver()
+
+	config := Config{Name: "reloadMock", Config: json.RawMessage(`{"name": "apply-closing"}`), LogLevel: InfoLevel}
+	logger, err := NewLogger(config)
+	if err != nil {
+		t.Fatalf("newlogger returned error: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; ; i++ {
+			// restarts the reaper and the sampler every time
+			config.Transactions.MaxAge = JSONDuration(time.Duration(i+1) * time.Hour)
+			config.Sampling = &SamplingConfig{RateLimit: float64(i + 1)}
+			if err := logger.ApplyConfig(config); err != nil {
+				if !strings.Contains(err.Error(), errLoggerClosed.Error()) {
+					t.Errorf("wanted reloads rejected once closed, got %v", err)
+				}
+				return
+			}
+		}
+	}()
+
+	time.Sleep(5 * time.Millisecond)
+	if err := logger.Close(); err != nil {
+		t.Fatalf("close returned error: %v", err)
+	}
+	<-done
+
+	if logger.reaper != nil {
+		select {
+		case <-logger.reaper.done:
+		default:
+			t.Error("wanted the reaper stopped after close")
+		}
+	}
+	if logger.sampler != nil {
+		t.Error("wanted the sampler stopped after close")
+	}
+}
+
+func TestApplyConfigRejected(t *testing.T) {
+	registerReloadDriver()
+
+	config := Config{Name: "reloadMock", Config: json.RawMessage(`{"name": "rejected"}`), LogLevel: InfoLevel}
+	logger, err := NewLogger(config)
+	if err != nil {
+		t.Fatalf("newlogger returned error: %v", err)
+	}
+	defer logger.Close()
+	driver := reloadDriver("rejected")
+
+	tests := []struct {
+		config Config
+		reason string
+	}{
+		{Config{Name: "reloadMock", Config: config.Config, LogLevel: LogLevel(42)}, "invalid log level"},
+		{Config{Name: "missing", Config: config.Config, LogLevel: DebugLevel}, "unknown driver"},
+		{Config{Name: "reloadMock", Config: config.Config, LogLevel: DebugLevel, Buffer: &BufferConfig{}}, "buffer"},
+	}
+	for _, tt := range tests {
+		err := logger.ApplyConfig(tt.config)
+		if err == nil || !strings.Contains(err.Error(), tt.reason) {
+			t.Errorf("wanted rejection for %s, got %v", tt.reason, err)
+		}
+	}
+
+	logger.Debug("still at info", nil)
+	logger.Info("old driver", nil)
+	if len(driver.logs) != 1 || driver.closed {
+		t.Errorf("wanted old config kept, got %v", driver.logs)
+	}
+}
+
+func TestApplyConfigWaitsForFlusher(t *testing.T) {
+	registerReloadDriver()
+
+	slow := &SlowDriver{delay: 50 * time.Millisecond}
+	logger := newBufferedLogger(slow, BufferConfig{QueueSize: 10, FlushInterval: JSONDuration(time.Hour)})
+	logger.config.Name = "slow"
+	defer logger.Close()
+
+	for i := 0; i < 10; i++ {
+		logger.Info("queued", nil)
+	}
+	// the full queue wakes the flusher, give it time to take the batch
+	time.Sleep(10 * time.Millisecond)
+
+	if err := logger.ApplyConfig(Config{Name: "reloadMock", Config: json.RawMessage(`{"name": "after-flush"}`), LogLevel: DebugLevel}); err != nil {
+		t.Fatalf("applyconfig returned error: %v", err)
+	}
+	if slow.count() != 10 {
+		t.Errorf("wanted the batch in flight written to the old driver, got %d", slow.count())
+	}
+}
+
+func writeConfigFile(t *testing.T, filename, level string) {
+	t.Helper()
+	content := `{"driver": "reloadMock", "driver_config": {"name": "watched"}, "log_level": "` + level + `"}`
+	if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWatchConfig(t *testing.T) {
+	registerReloadDriver()
+
+	filename := filepath.Join(t.TempDir(), "config.json")
+	writeConfigFile(t, filename, "info")
+	config, err := LoadConfig(filename)
+	if err != nil {
+		t.Fatalf("loadconfig returned error: %v", err)
+	}
+
+	logger, err := NewLogger(config, WatchConfig(filename, 5*time.Millisecond))
+	if err != nil {
+		t.Fatalf("newlogger returned error: %v", err)
+	}
+	defer logger.Close()
+
+	var mu sync.Mutex
+	var reported []error
+	logger.SetErrorHandler(func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		reported = append(reported, err)
+	})
+
+	writeConfigFile(t, filename, "error")
+	// make sure the change is seen on file systems with coarse timestamps
+	os.Chtimes(filename, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	waitFor(t, "file reload", func() bool { return !logger.enabled(WarningLevel) })
+
+	os.WriteFile(filename, []byte(`{"driver": "reloadMock", "log_level": "loud"}`), 0o644)
+	os.Chtimes(filename, time.Now().Add(2*time.Minute), time.Now().Add(2*time.Minute))
+	waitFor(t, "rejected reload", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(reported) > 0
+	})
+	if !strings.Contains(reported[0].Error(), "config reload rejected") || logger.enabled(WarningLevel) {
+		t.Errorf("wanted reload rejected and the old level kept, got %v", reported[0])
+	}
+
+	writeConfigFile(t, filename, "debug")
+	process, _ := os.FindProcess(os.Getpid())
+	if err := process.Signal(syscall.SIGHUP); err != nil {
+		t.Skipf("can't send SIGHUP: %v", err)
+	}
+	waitFor(t, "SIGHUP reload", func() bool { return logger.enabled(DebugLevel) })
+}
@@ -0,0 +1,196 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net"
+	"time"
+)
+
+const (
+	defaultMaxAttempts    = 3
+	defaultInitialBackoff = 100 * time.Millisecond
+	defaultMaxBackoff     = 10 * time.Second
+	defaultMultiplier     = 2
+)
+
+// RetryConfig wraps the configured driver in a RetryDriver. Entries that
+// still fail after MaxAttempts are written to the DeadLetter driver.
+type RetryConfig struct {
+	MaxAttempts    int           `json:"max_attempts"`
+	InitialBackoff JSONDuration  `json:"initial_backoff"`
+	MaxBackoff     JSONDuration  `json:"max_backoff"`
+	Multiplier     float64       `json:"multiplier"`
+	Jitter         float64       `json:"jitter"`
+	DeadLetter     *DriverConfig `json:"dead_letter,omitempty"`
+}
+
+type DriverConfig struct {
+	Name   string          `json:"driver"`
+	Config json.RawMessage `json:"driver_config"`
+}
+
+// UndeliveredError is returned by drivers that batch entries when a batch
+// couldn't be sent. Logs holds the entries that were not delivered, so the
+// caller can retry or dead-letter exactly those.
+type UndeliveredError struct {
+	Logs []Log
+	Err  error
+}
+
+func (e *UndeliveredError) Error() string {
+	return fmt.Sprintf("%d log entries not delivered: %v", len(e.Logs), e.Err)
+}
+
+func (e *UndeliveredError) Unwrap() error {
+	return e.Err
+}
+
+// IsRetryable is the default retry classifier. Errors that implement
+// Retryable() bool decide for themselves, network errors are retried and
+// everything else is not.
+func IsRetryable(err error) bool {
+	var classified interface{ Retryable() bool }
+	if errors.As(err, &classified) {
+		return classified.Retryable()
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// RetryDriver retries failed writes to the wrapped driver with exponential
+// backoff. Retries block the caller, so it is best combined with buffering.
+type RetryDriver struct {
+	driver     Driver
+	deadLetter Driver
+	config     RetryConfig
+	retryable  func(error) bool
+	sleep      func(time.Duration)
+}
+
+// NewRetryDriver wraps driver. deadLetter may be nil, in which case the last
+// error is returned once all attempts failed. A nil retryable uses
+// IsRetryable.
+func NewRetryDriver(driver Driver, config RetryConfig, deadLetter Driver, retryable func(error) bool) *RetryDriver {
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaultMaxAttempts
+	}
+	if config.InitialBackoff <= 0 {
+		config.InitialBackoff = JSONDuration(defaultInitialBackoff)
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = JSONDuration(defaultMaxBackoff)
+	}
+	if config.Multiplier <= 0 {
+		config.Multiplier = defaultMultiplier
+	}
+	if retryable == nil {
+		retryable = IsRetryable
+	}
+
+	return &RetryDriver{
+		driver:     driver,
+		deadLetter: deadLetter,
+		config:     config,
+		retryable:  retryable,
+		sleep:      time.Sleep,
+	}
+}
+
+func (r *RetryDriver) Log(log Log) error {
+	return r.deliver(func() error { return r.driver.Log(log) }, []Log{log})
+}
+
+func (r *RetryDriver) Flush() error {
+	flusher, ok := r.driver.(Flusher)
+	if !ok {
+		return nil
+	}
+	return r.deliver(flusher.Flush, nil)
+}
+
+func (r *RetryDriver) Close() error {
+	err := r.driver.Close()
+	if r.deadLetter != nil {
+		err = errors.Join(err, r.deadLetter.Close())
+	}
+	return err
+}
+
+func (r *RetryDriver) deliver(send func() error, entries []Log) error {
+	// a batching driver only buffers the entry, its other errors can be
+	// left over from an earlier background flush and say nothing about
+	// which entries were lost
+	_, batching := r.driver.(Flusher)
+	pending := entries
+	if batching {
+		pending = nil
+	}
+	resend := batching
+
+	err := send()
+	for attempt := 1; err != nil; attempt++ {
+		var undelivered *UndeliveredError
+		if errors.As(err, &undelivered) {
+			pending = undelivered.Logs
+			resend = true
+		} else if batching {
+			pending = nil
+		}
+
+		if attempt >= r.config.MaxAttempts || !r.retryable(err) {
+			return r.giveUp(pending, attempt, err)
+		}
+
+		r.sleep(r.backoff(attempt))
+
+		// entries a batching driver handed back have to be logged again,
+		// calling send would log the current entry a second time
+		if resend {
+			err = r.resend(pending)
+		} else {
+			err = send()
+		}
+	}
+	return nil
+}
+
+func (r *RetryDriver) resend(entries []Log) error {
+	var err error
+	for _, log := range entries {
+		err = errors.Join(err, r.driver.Log(log))
+	}
+	if flusher, ok := r.driver.(Flusher); ok {
+		err = errors.Join(err, flusher.Flush())
+	}
+	return err
+}
+
+func (r *RetryDriver) giveUp(entries []Log, attempts int, err error) error {
+	err = fmt.Errorf("giving up after %d attempts: %w", attempts, err)
+	if r.deadLetter == nil || len(entries) == 0 {
+		return err
+	}
+
+	var deadLetterErr error
+	for _, log := range entries {
+		deadLetterErr = errors.Join(deadLetterErr, r.deadLetter.Log(log))
+	}
+	if deadLetterErr != nil {
+		return errors.Join(err, fmt.Errorf("dead letter failed: %w", deadLetterErr))
+	}
+	return nil
+}
+
+func (r *RetryDriver) backoff(attempt int) time.Duration {
+	delay := float64(r.config.InitialBackoff) * math.Pow(r.config.Multiplier, float64(attempt-1))
+	delay = math.Min(delay, float64(r.config.MaxBackoff))
+	if r.config.Jitter > 0 {
+		delay += delay * r.config.Jitter * (rand.Float64()*2 - 1)
+	}
+	return time.Duration(delay)
+}
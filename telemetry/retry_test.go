@@ -0,0 +1,193 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+type retryableError struct {
+	retryable bool
+}
+
+func (e retryableError) Error() string {
+	return "mock error"
+}
+
+func (e retryableError) Retryable() bool {
+	return e.retryable
+}
+
+type FailingDriver struct {
+	MockDriver
+	failures int
+	err      error
+	calls    int
+}
+
+func (f *FailingDriver) Log(log Log) error {
+	f.calls++
+	if f.calls <= f.failures {
+		return f.err
+	}
+	return f.MockDriver.Log(log)
+}
+
+func newTestRetryDriver(driver Driver, deadLetter Driver) (*RetryDriver, *[]time.Duration) {
+	retry := NewRetryDriver(driver, RetryConfig{MaxAttempts: 3, InitialBackoff: JSONDuration(time.Millisecond)}, deadLetter, nil)
+	var sleeps []time.Duration
+	retry.sleep = func(d time.Duration) {
+		sleeps = append(sleeps, d)
+	}
+	return retry, &sleeps
+}
+
+func TestRetrySucceeds(t *testing.T) {
+	driver := &FailingDriver{failures: 2, err: retryableError{true}}
+	retry, sleeps := newTestRetryDriver(driver, nil)
+
+	if err := retry.Log(Log{Message: "retry me"}); err != nil {
+		t.Fatalf("log returned error: %v", err)
+	}
+	if driver.calls != 3 {
+		t.Errorf("wanted 3 attempts, got %d", driver.calls)
+	}
+	if len(*sleeps) != 2 || (*sleeps)[1] <= (*sleeps)[0] {
+		t.Errorf("wanted 2 growing backoffs, got %v", *sleeps)
+	}
+}
+
+func TestRetryNotRetryable(t *testing.T) {
+	driver := &FailingDriver{failures: 5, err: retryableError{false}}
+	retry, _ := newTestRetryDriver(driver, nil)
+
+	if err := retry.Log(Log{Message: "bad request"}); err == nil {
+		t.Fatal("wanted error, got nil")
+	}
+	if driver.calls != 1 {
+		t.Errorf("wanted no retries, got %d calls", driver.calls)
+	}
+}
+
+func TestRetryDeadLetter(t *testing.T) {
+	driver := &FailingDriver{failures: 5, err: retryableError{true}}
+	deadLetter := &MockDriver{}
+	retry, _ := newTestRetryDriver(driver, deadLetter)
+
+	if err := retry.Log(Log{Message: "lost"}); err != nil {
+		t.Fatalf("wanted nil error once dead lettered, got %v", err)
+	}
+	if driver.calls != 3 {
+		t.Errorf("wanted 3 attempts, got %d", driver.calls)
+	}
+	if len(deadLetter.logs) != 1 || deadLetter.logs[0].Message != "lost" {
+		t.Errorf("wanted entry in dead letter, got %v", deadLetter.logs)
+	}
+}
+
+type BatchingDriver struct {
+	MockDriver
+	pending  []Log
+	failures int
+	// leftover is returned by the next Log, like the error of a
+	// background flush
+	leftover error
+}
+
+func (b *BatchingDriver) Log(log Log) error {
+	b.pending = append(b.pending, log)
+	err := b.leftover
+	b.leftover = nil
+	return err
+}
+
+func (b *BatchingDriver) Flush() error {
+	pending := b.pending
+	b.pending = nil
+	if b.failures > 0 {
+		b.failures--
+		return &UndeliveredError{Logs: pending, Err: retryableError{true}}
+	}
+	for _, log := range pending {
+		b.MockDriver.Log(log)
+	}
+	return nil
+}
+
+func TestRetryUndeliveredBatch(t *testing.T) {
+	driver := &BatchingDriver{failures: 1}
+	retry, _ := newTestRetryDriver(driver, nil)
+
+	retry.Log(Log{Message: "first"})
+	retry.Log(Log{Message: "second"})
+	if err := retry.Flush(); err != nil {
+		t.Fatalf("flush returned error: %v", err)
+	}
+
+	if len(driver.logs) != 2 {
+		t.Errorf("wanted both entries delivered once, got %v", driver.logs)
+	}
+}
+
+func TestRetryBackgroundFlushError(t *testing.T) {
+	driver := &BatchingDriver{leftover: &UndeliveredError{Logs: []Log{{Message: "rejected"}}, Err: retryableError{false}}}
+	deadLetter := &MockDriver{}
+	retry, _ := newTestRetryDriver(driver, deadLetter)
+
+	if err := retry.Log(Log{Message: "buffered"}); err != nil {
+		t.Fatalf("wanted nil error once dead lettered, got %v", err)
+	}
+	if len(deadLetter.logs) != 1 || deadLetter.logs[0].Message != "rejected" {
+		t.Errorf("wanted only the rejected entry dead lettered, got %v", deadLetter.logs)
+	}
+
+	driver.leftover = retryableError{false}
+	if err := retry.Log(Log{Message: "next"}); err == nil {
+		t.Error("wanted the background error returned")
+	}
+	if len(deadLetter.logs) != 1 {
+		t.Errorf("wanted the current entry kept out of the dead letter, got %v", deadLetter.logs)
+	}
+
+	if err := retry.Flush(); err != nil {
+		t.Fatalf("flush returned error: %v", err)
+	}
+	if len(driver.logs) != 2 || driver.logs[0].Message != "buffered" || driver.logs[1].Message != "next" {
+		t.Errorf("wanted the buffered entries delivered once, got %v", driver.logs)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	if IsRetryable(errors.New("plain")) {
+		t.Error("plain errors shouldn't be retryable")
+	}
+	if !IsRetryable(&UndeliveredError{Err: retryableError{true}}) {
+		t.Error("wanted wrapped retryable error to be retryable")
+	}
+}
+
+func TestRetryConfigDeadLetter(t *testing.T) {
+	err := RegisterDriver("mockDeadLetter", func(config json.RawMessage) (Driver, error) {
+		return &MockDriver{}, nil
+	})
+	if err != nil {
+		t.Fatalf("registerdriver gave error: %v", err)
+	}
+
+	driver, err := getDriver(Config{
+		Name:  "mockDeadLetter",
+		Retry: &RetryConfig{DeadLetter: &DriverConfig{Name: "mockDeadLetter"}},
+	})
+	if err != nil {
+		t.Fatalf("getdriver returned error: %v", err)
+	}
+
+	retry, ok := driver.(*RetryDriver)
+	if !ok {
+		t.Fatalf("wanted RetryDriver, got %T", driver)
+	}
+	if retry.deadLetter == nil {
+		t.Error("wanted dead letter driver")
+	}
+}
@@ -0,0 +1,235 @@
+package telemetry
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	defaultSamplingTick    = time.Second
+	defaultSummaryInterval = 10 * time.Second
+	suppressedMessage      = "log entries suppressed"
+)
+
+// SamplingRule keeps the first Initial entries with the same level and
+// message in every tick and after that every Thereafter-th one. With
+// Thereafter at 0 the rest are dropped, a rule with both at 0 keeps every
+// entry.
+type SamplingRule struct {
+	Initial    int `json:"initial"`
+	Thereafter int `json:"thereafter"`
+}
+
+// SamplingConfig limits how many entries reach the driver. The rule is
+// applied per level and message, Levels replaces it for single levels.
+// Entries that pass it take a token from a bucket that holds Burst tokens
+// and is refilled with RateLimit tokens per second, entries that find it
+// empty are dropped. A RateLimit of 0 turns the bucket off.
+//
+// How many entries were dropped is logged as a warning every
+// SummaryInterval. Panic and fatal entries are never dropped.
+type SamplingConfig struct {
+	SamplingRule
+	Tick            JSONDuration              `json:"tick"`
+	Levels          map[LogLevel]SamplingRule `json:"levels,omitempty"`
+	RateLimit       float64                   `json:"rate_limit"`
+	Burst           int                       `json:"burst"`
+	SummaryInterval JSONDuration              `json:"summary_interval"`
+}
+
+type samplingKey struct {
+	level   LogLevel
+	message string
+}
+
+// sampler is used under the mutex of the logger.
+type sampler struct {
+	config SamplingConfig
+	tick   time.Duration
+
+	window time.Time
+	counts map[samplingKey]int
+
+	tokens float64
+	burst  float64
+	filled time.Time
+
+	sampled     map[LogLevel]int
+	rateLimited map[LogLevel]int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newSampler(config SamplingConfig) *sampler {
+	s := &sampler{
+		config:      config,
+		tick:        time.Duration(config.Tick),
+		counts:      make(map[samplingKey]int),
+		burst:       float64(config.Burst),
+		sampled:     make(map[LogLevel]int),
+		rateLimited: make(map[LogLevel]int),
+	}
+	if s.tick <= 0 {
+		s.tick = defaultSamplingTick
+	}
+	if s.burst <= 0 {
+		s.burst = config.RateLimit
+		if s.burst < 1 {
+			s.burst = 1
+		}
+	}
+	s.tokens = s.burst
+	return s
+}
+
+func (s *sampler) allow(log Log) bool {
+	if log.Level >= PanicLevel {
+		return true
+	}
+
+	rule, ok := s.config.Levels[log.Level]
+	if !ok {
+		rule = s.config.SamplingRule
+	}
+	if rule.Initial > 0 || rule.Thereafter > 0 {
+		if log.Timestamp.Sub(s.window) >= s.tick {
+			s.window = log.Timestamp
+			s.counts = make(map[samplingKey]int)
+		}
+		key := samplingKey{log.Level, log.Message}
+		s.counts[key]++
+		n := s.counts[key]
+		if n > rule.Initial && (rule.Thereafter == 0 || (n-rule.Initial)%rule.Thereafter != 0) {
+			s.sampled[log.Level]++
+			return false
+		}
+	}
+
+	if s.config.RateLimit > 0 {
+		if !s.filled.IsZero() {
+			s.tokens += log.Timestamp.Sub(s.filled).Seconds() * s.config.RateLimit
+			if s.tokens > s.burst {
+				s.tokens = s.burst
+			}
+		}
+		s.filled = log.Timestamp
+		if s.tokens < 1 {
+			s.rateLimited[log.Level]++
+			return false
+		}
+		s.tokens--
+	}
+	return true
+}
+
+// summary returns the fields of the summary entry and resets the counts,
+// it returns nil when nothing was dropped.
+func (s *sampler) summary() []Field {
+	if len(s.sampled) == 0 && len(s.rateLimited) == 0 {
+		return nil
+	}
+
+	perLevel := make(map[LogLevel]int)
+	var sampled, rateLimited int
+	for level, n := range s.sampled {
+		sampled += n
+		perLevel[level] += n
+	}
+	for level, n := range s.rateLimited {
+		rateLimited += n
+		perLevel[level] += n
+	}
+	levels := make([]LogLevel, 0, len(perLevel))
+	for level := range perLevel {
+		levels = append(levels, level)
+	}
+	sort.Slice(levels, func(i, j int) bool { return levels[i] < levels[j] })
+
+	fields := []Field{Int("sampled", sampled), Int("rate_limited", rateLimited)}
+	for _, level := range levels {
+		fields = append(fields, Int("suppressed_"+level.String(), perLevel[level]))
+	}
+
+	s.sampled = make(map[LogLevel]int)
+	s.rateLimited = make(map[LogLevel]int)
+	return fields
+}
+
+// startSampler turns sampling on, the caller owns the logger or holds the
+// reloadMutex.
+func (l *Logger) startSampler(config SamplingConfig) {
+	interval := time.Duration(config.SummaryInterval)
+	if interval <= 0 {
+		interval = defaultSummaryInterval
+	}
+
+	s := newSampler(config)
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+
+	l.mutex.Lock()
+	l.sampler = s
+	l.mutex.Unlock()
+
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				l.reportSuppressed(s)
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// stopSampler turns sampling off and logs what was dropped since the last
+// summary.
+func (l *Logger) stopSampler() {
+	l.mutex.Lock()
+	s := l.sampler
+	l.sampler = nil
+	l.mutex.Unlock()
+
+	if s == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+	l.reportSuppressed(s)
+}
+
+// reportSuppressed logs the summary of s, it isn't sampled itself.
+func (l *Logger) reportSuppressed(s *sampler) {
+	l.mutex.Lock()
+	fields := s.summary()
+	var tags map[string]string
+	if len(fields) > 0 && len(l.config.DefaultTags) > 0 {
+		tags = make(map[string]string, len(l.config.DefaultTags))
+		for k, v := range l.config.DefaultTags {
+			tags[k] = v
+		}
+	}
+	l.mutex.Unlock()
+
+	if len(fields) == 0 {
+		return
+	}
+	log := Log{
+		Timestamp: time.Now(),
+		Level:     WarningLevel,
+		Message:   suppressedMessage,
+		Tags:      tags,
+		Fields:    fields,
+	}
+	if err := l.write(log); err != nil {
+		l.handleError(fmt.Errorf("failed to log suppressed entries: %v", err))
+	}
+}
@@ -0,0 +1,159 @@
+package telemetry
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSamplerRules(t *testing.T) {
+	s := newSampler(SamplingConfig{
+		SamplingRule: SamplingRule{Initial: 2, Thereafter: 3},
+		Levels:       map[LogLevel]SamplingRule{ErrorLevel: {}},
+	})
+	start := time.Now()
+
+	var kept []int
+	for i := 1; i <= 10; i++ {
+		if s.allow(Log{Timestamp: start, Level: WarningLevel, Message: "disk full"}) {
+			kept = append(kept, i)
+		}
+	}
+	if len(kept) != 4 || kept[2] != 5 || kept[3] != 8 {
+		t.Errorf("wanted entries 1, 2, 5 and 8 kept, got %v", kept)
+	}
+
+	if !s.allow(Log{Timestamp: start, Level: WarningLevel, Message: "other message"}) {
+		t.Error("wanted a different message counted on its own")
+	}
+	if !s.allow(Log{Timestamp: start.Add(time.Second), Level: WarningLevel, Message: "disk full"}) {
+		t.Error("wanted the counts reset after a tick")
+	}
+	for i := 0; i < 10; i++ {
+		if !s.allow(Log{Timestamp: start, Level: ErrorLevel, Message: "disk full"}) {
+			t.Fatal("wanted errors kept, their rule turns sampling off")
+		}
+	}
+
+	fields := s.summary()
+	if len(fields) != 3 || fields[0].Value != int64(6) || fields[1].Value != int64(0) || fields[2].Key != "suppressed_warning" {
+		t.Errorf("unexpected summary %v", fields)
+	}
+	if s.summary() != nil {
+		t.Error("wanted the counts reset by the summary")
+	}
+}
+
+func TestSamplerRateLimit(t *testing.T) {
+	s := newSampler(SamplingConfig{RateLimit: 2, Burst: 3})
+	start := time.Now()
+
+	var kept int
+	for i := 0; i < 5; i++ {
+		if s.allow(Log{Timestamp: start, Level: InfoLevel, Message: "request"}) {
+			kept++
+		}
+	}
+	if kept != 3 {
+		t.Errorf("wanted the burst of 3 kept, got %d", kept)
+	}
+
+	if !s.allow(Log{Timestamp: start.Add(500 * time.Millisecond), Level: InfoLevel, Message: "request"}) {
+		t.Error("wanted a token refilled after half a second")
+	}
+	if s.allow(Log{Timestamp: start.Add(500 * time.Millisecond), Level: InfoLevel, Message: "request"}) {
+		t.Error("wanted the bucket empty again")
+	}
+	if !s.allow(Log{Timestamp: start, Level: FatalLevel, Message: "request"}) {
+		t.Error("wanted fatal entries never dropped")
+	}
+
+	fields := s.summary()
+	if len(fields) != 3 || fields[1].Value != int64(3) || fields[2].Key != "suppressed_info" {
+		t.Errorf("unexpected summary %v", fields)
+	}
+}
+
+func TestLoggerSampling(t *testing.T) {
+	logger, mockDriver := newTransactionTestLogger(Config{
+		LogLevel:    InfoLevel,
+		DefaultTags: map[string]string{"environment": "test"},
+	})
+	logger.startSampler(SamplingConfig{
+		SamplingRule:    SamplingRule{Initial: 1},
+		SummaryInterval: JSONDuration(time.Hour),
+	})
+
+	for i := 0; i < 5; i++ {
+		logger.Warning("connection refused", nil)
+	}
+	logger.Named("db").Warning("connection refused", nil)
+	if len(mockDriver.logs) != 1 {
+		t.Fatalf("wanted 1 log, got %d", len(mockDriver.logs))
+	}
+
+	logger.stopSampler()
+	if len(mockDriver.logs) != 2 {
+		t.Fatalf("wanted a summary when sampling stops, got %d logs", len(mockDriver.logs))
+	}
+	summary := mockDriver.logs[1]
+	values := summary.Values()
+	if summary.Message != suppressedMessage || summary.Level != WarningLevel || values["sampled"] != int64(5) || values["environment"] != "test" {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+
+	logger.Warning("connection refused", nil)
+	logger.Warning("connection refused", nil)
+	if len(mockDriver.logs) != 4 {
+		t.Errorf("wanted every entry kept without sampling, got %d logs", len(mockDriver.logs))
+	}
+}
+
+func TestSamplingSummaryInterval(t *testing.T) {
+	logger, mockDriver := newTransactionTestLogger(Config{LogLevel: InfoLevel})
+	logger.startSampler(SamplingConfig{
+		RateLimit:       1,
+		SummaryInterval: JSONDuration(10 * time.Millisecond),
+	})
+	defer logger.stopSampler()
+
+	logger.Info("first", nil)
+	logger.Info("second", nil)
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		logger.mutex.Lock()
+		count := len(mockDriver.logs)
+		logger.mutex.Unlock()
+		if count == 2 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+	if len(mockDriver.logs) != 2 || mockDriver.logs[1].Message != suppressedMessage {
+		t.Fatalf("wanted a periodic summary, got %v", mockDriver.logs)
+	}
+}
+
+func TestSamplingConfig(t *testing.T) {
+	var config Config
+	err := DecodeStrict([]byte(`{
+		"driver": "console",
+		"driver_config": {},
+		"sampling": {"initial": 100, "thereafter": -1, "levels": {"warn": {"initial": 10}, "error": {"initial": -1}}, "rate_limit": 500}
+	}`), &config)
+	if err != nil {
+		t.Fatalf("decodestrict returned error: %v", err)
+	}
+	if rule := config.Sampling.Levels[WarningLevel]; rule.Initial != 10 || config.Sampling.Initial != 100 {
+		t.Fatalf("unexpected sampling config %+v", config.Sampling)
+	}
+
+	err = validateConfig(config)
+	want := "config validation failed: sampling.thereafter: sampling thereafter can't be negative; sampling.levels.error.initial: sampling initial can't be negative"
+	if err == nil || err.Error() != want {
+		t.Errorf("wanted %q, got %v", want, err)
+	}
+}
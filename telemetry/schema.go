@@ -0,0 +1,194 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var registeredSchemas = make(map[string]json.RawMessage)
+
+// RegisterDriverSchema adds the JSON Schema of a registered driver's
+// driver_config to ConfigSchema. Schemas can refer to the definitions
+// "#/definitions/driver" for a nested driver and driver_config,
+// "#/definitions/level" and "#/definitions/duration".
+func RegisterDriverSchema(name string, schema json.RawMessage) error {
+	if _, ok := registeredDrivers[name]; !ok {
+		return fmt.Errorf("unknown driver: %s", name)
+	}
+	if _, ok := registeredSchemas[name]; ok {
+		return fmt.Errorf("driver schema already registered: %s", name)
+	}
+	if !json.Valid(schema) {
+		return fmt.Errorf("invalid schema for driver %s", name)
+	}
+	registeredSchemas[name] = schema
+	return nil
+}
+
+// SchemaFor builds a JSON Schema for the type of v from its json struct
+// tags. Embedded structs are flattened, LogLevel and JSONDuration refer to
+// the shared definitions and unknown fields are not allowed. The jsonschema
+// tag can mark a field "required" and list allowed values like
+// `jsonschema:"required,enum=stdout|stderr"`.
+func SchemaFor(v any) json.RawMessage {
+	schema, _ := json.Marshal(schemaForType(reflect.TypeOf(v)))
+	return schema
+}
+
+var (
+	logLevelType     = reflect.TypeOf(LogLevel(0))
+	jsonDurationType = reflect.TypeOf(JSONDuration(0))
+	rawMessageType   = reflect.TypeOf(json.RawMessage{})
+	driverConfigType = reflect.TypeOf(DriverConfig{})
+)
+
+func schemaForType(t reflect.Type) map[string]any {
+	switch t {
+	case logLevelType:
+		return map[string]any{"$ref": "#/definitions/level"}
+	case jsonDurationType:
+		return map[string]any{"$ref": "#/definitions/duration"}
+	case rawMessageType:
+		return map[string]any{}
+	case driverConfigType:
+		return map[string]any{"$ref": "#/definitions/driver"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaForType(t.Elem())
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": schemaForType(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaForType(t.Elem())}
+	case reflect.Struct:
+		properties := make(map[string]any)
+		var required []string
+		addStructFields(t, properties, &required)
+		schema := map[string]any{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+		if len(required) > 0 {
+			sort.Strings(required)
+			schema["required"] = required
+		}
+		return schema
+	}
+	return map[string]any{}
+}
+
+func addStructFields(t reflect.Type, properties map[string]any, required *[]string) {
+	eachJSONField(t, func(name string, field reflect.StructField) {
+		schema := schemaForType(field.Type)
+		for _, option := range strings.Split(field.Tag.Get("jsonschema"), ",") {
+			switch {
+			case option == "required":
+				*required = append(*required, name)
+			case strings.HasPrefix(option, "enum="):
+				schema["enum"] = strings.Split(strings.TrimPrefix(option, "enum="), "|")
+			}
+		}
+		properties[name] = schema
+	})
+}
+
+// eachJSONField calls fn with the JSON name of every field of t, with the
+// fields of embedded structs flattened like encoding/json does.
+func eachJSONField(t reflect.Type, fn func(name string, field reflect.StructField)) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			eachJSONField(field.Type, fn)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fn(name, field)
+	}
+}
+
+// ConfigSchema returns a JSON Schema for Config files. The driver_config of
+// every driver with a registered schema is checked against it, depending on
+// the driver name.
+func ConfigSchema() ([]byte, error) {
+	names := make([]string, 0, len(registeredDrivers))
+	for name := range registeredDrivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var conditions []any
+	for _, name := range names {
+		schema, ok := registeredSchemas[name]
+		if !ok {
+			continue
+		}
+		conditions = append(conditions, map[string]any{
+			"if": map[string]any{
+				"properties": map[string]any{"driver": map[string]any{"const": name}},
+				"required":   []string{"driver"},
+			},
+			"then": map[string]any{
+				"properties": map[string]any{"driver_config": schema},
+			},
+		})
+	}
+
+	driver := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"driver":        map[string]any{"type": "string", "enum": names},
+			"driver_config": map[string]any{},
+		},
+		"required": []string{"driver", "driver_config"},
+	}
+	if len(conditions) > 0 {
+		driver["allOf"] = conditions
+	}
+
+	levels := []string{"warn"}
+	for level := TraceLevel; level <= FatalLevel; level++ {
+		levels = append(levels, level.String())
+	}
+
+	schema := schemaForType(reflect.TypeOf(Config{}))
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "telemetry config"
+	schema["allOf"] = []any{map[string]any{"$ref": "#/definitions/driver"}}
+	schema["definitions"] = map[string]any{
+		"driver": driver,
+		"level": map[string]any{
+			"anyOf": []any{
+				map[string]any{"type": "string", "enum": levels},
+				map[string]any{"type": "integer", "minimum": int(TraceLevel), "maximum": int(FatalLevel)},
+			},
+		},
+		"duration": map[string]any{
+			"type":    "string",
+			"pattern": `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$|^0$`,
+		},
+	}
+
+	return json.MarshalIndent(schema, "", "  ")
+}
@@ -0,0 +1,127 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSchemaFor(t *testing.T) {
+	type embedded struct {
+		Format string `json:"format"`
+	}
+	type example struct {
+		embedded
+		Host     string            `json:"host" jsonschema:"required"`
+		Mode     string            `json:"mode" jsonschema:"enum=fast|safe"`
+		Level    LogLevel          `json:"level"`
+		Timeout  JSONDuration      `json:"timeout"`
+		Headers  map[string]string `json:"headers"`
+		Ports    []int             `json:"ports"`
+		Enabled  *bool             `json:"enabled,omitempty"`
+		Ignored  string            `json:"-"`
+		internal string
+	}
+
+	var schema map[string]any
+	if err := json.Unmarshal(SchemaFor(example{}), &schema); err != nil {
+		t.Fatalf("schema isn't valid json: %v", err)
+	}
+
+	want := map[string]any{
+		"type":                 "object",
+		"additionalProperties": false,
+		"required":             []any{"host"},
+		"properties": map[string]any{
+			"format":  map[string]any{"type": "string"},
+			"host":    map[string]any{"type": "string"},
+			"mode":    map[string]any{"type": "string", "enum": []any{"fast", "safe"}},
+			"level":   map[string]any{"$ref": "#/definitions/level"},
+			"timeout": map[string]any{"$ref": "#/definitions/duration"},
+			"headers": map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "string"}},
+			"ports":   map[string]any{"type": "array", "items": map[string]any{"type": "integer"}},
+			"enabled": map[string]any{"type": "boolean"},
+		},
+	}
+	if !reflect.DeepEqual(schema, want) {
+		t.Errorf("unexpected schema\n got: %v\nwant: %v", schema, want)
+	}
+}
+
+func TestConfigSchema(t *testing.T) {
+	RegisterDriver("testSchema", func(config json.RawMessage) (Driver, error) {
+		return &MockDriver{}, nil
+	})
+	RegisterDriverSchema("testSchema", json.RawMessage(`{"type": "string"}`))
+
+	if err := RegisterDriverSchema("testSchema", json.RawMessage(`{}`)); err == nil {
+		t.Error("wanted error registering a schema twice")
+	}
+	if err := RegisterDriverSchema("testSchemaMissing", json.RawMessage(`{}`)); err == nil {
+		t.Error("wanted error registering a schema for an unknown driver")
+	}
+
+	data, err := ConfigSchema()
+	if err != nil {
+		t.Fatalf("configschema returned error: %v", err)
+	}
+	var schema struct {
+		Properties  map[string]json.RawMessage `json:"properties"`
+		Definitions struct {
+			Driver struct {
+				Properties struct {
+					Driver struct {
+						Enum []string `json:"enum"`
+					} `json:"driver"`
+				} `json:"properties"`
+				AllOf []struct {
+					If struct {
+						Properties struct {
+							Driver struct {
+								Const string `json:"const"`
+							} `json:"driver"`
+						} `json:"properties"`
+					} `json:"if"`
+					Then struct {
+						Properties struct {
+							DriverConfig json.RawMessage `json:"driver_config"`
+						} `json:"properties"`
+					} `json:"then"`
+				} `json:"allOf"`
+			} `json:"driver"`
+		} `json:"definitions"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("schema isn't valid json: %v", err)
+	}
+
+	for _, key := range []string{"driver", "driver_config", "log_level", "components", "default_tags", "buffer", "retry", "transactions"} {
+		if _, ok := schema.Properties[key]; !ok {
+			t.Errorf("wanted %s in the config schema", key)
+		}
+	}
+
+	found := false
+	for _, condition := range schema.Definitions.Driver.AllOf {
+		if condition.If.Properties.Driver.Const == "testSchema" {
+			var driverConfig map[string]string
+			json.Unmarshal(condition.Then.Properties.DriverConfig, &driverConfig)
+			found = driverConfig["type"] == "string"
+		}
+	}
+	if !found {
+		t.Error("wanted the registered driver schema applied to driver_config")
+	}
+	if !contains(schema.Definitions.Driver.Properties.Driver.Enum, "testSchema") {
+		t.Error("wanted registered drivers listed")
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
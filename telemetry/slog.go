@@ -0,0 +1,122 @@
+package telemetry
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SlogHandler is a slog.Handler that writes records through a Logger, so
+// they get the logger's default tags and drivers. Attributes become typed
+// fields, group names are flattened into dotted keys. Transaction IDs and
+// tags carried by the context are attached as well.
+type SlogHandler struct {
+	logger *Logger
+	fields []Field
+	prefix string
+}
+
+func NewSlogHandler(logger *Logger) *SlogHandler {
+	return &SlogHandler{logger: logger}
+}
+
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.logger.enabled(slogLevel(level))
+}
+
+func (h *SlogHandler) Handle(ctx context.Context, record slog.Record) error {
+	fields := make([]Field, len(h.fields), len(h.fields)+record.NumAttrs())
+	copy(fields, h.fields)
+	record.Attrs(func(attr slog.Attr) bool {
+		fields = appendAttr(fields, h.prefix, attr)
+		return true
+	})
+
+	log, ok := h.logger.newLog(slogLevel(record.Level), record.Message, TagsFromContext(ctx), fields, TransactionFromContext(ctx))
+	if !ok {
+		return nil
+	}
+	if !record.Time.IsZero() {
+		log.Timestamp = record.Time
+	}
+	return h.logger.write(log)
+}
+
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+
+	fields := make([]Field, len(h.fields), len(h.fields)+len(attrs))
+	copy(fields, h.fields)
+	for _, attr := range attrs {
+		fields = appendAttr(fields, h.prefix, attr)
+	}
+	return &SlogHandler{logger: h.logger, fields: fields, prefix: h.prefix}
+}
+
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &SlogHandler{logger: h.logger, fields: h.fields, prefix: h.prefix + name + "."}
+}
+
+func slogLevel(level slog.Level) LogLevel {
+	switch {
+	case level < slog.LevelDebug:
+		return TraceLevel
+	case level < slog.LevelInfo:
+		return DebugLevel
+	case level < slog.LevelWarn:
+		return InfoLevel
+	case level < slog.LevelError:
+		return WarningLevel
+	default:
+		return ErrorLevel
+	}
+}
+
+func appendAttr(fields []Field, prefix string, attr slog.Attr) []Field {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return fields
+	}
+
+	key := prefix + attr.Key
+	value := attr.Value
+
+	switch value.Kind() {
+	case slog.KindGroup:
+		group := value.Group()
+		if len(group) == 0 {
+			return fields
+		}
+		// groups without a key are inlined, like the slog handlers do
+		if attr.Key != "" {
+			prefix = key + "."
+		}
+		for _, member := range group {
+			fields = appendAttr(fields, prefix, member)
+		}
+		return fields
+	case slog.KindString:
+		return append(fields, String(key, value.String()))
+	case slog.KindInt64:
+		return append(fields, Int64(key, value.Int64()))
+	case slog.KindUint64:
+		return append(fields, Any(key, value.Uint64()))
+	case slog.KindFloat64:
+		return append(fields, Float(key, value.Float64()))
+	case slog.KindBool:
+		return append(fields, Bool(key, value.Bool()))
+	case slog.KindDuration:
+		return append(fields, Duration(key, value.Duration()))
+	case slog.KindTime:
+		return append(fields, Time(key, value.Time()))
+	default:
+		if err, ok := value.Any().(error); ok {
+			return append(fields, Field{Key: key, Value: err})
+		}
+		return append(fields, Any(key, value.Any()))
+	}
+}
@@ -0,0 +1,98 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestSlogHandler(t *testing.T) {
+	logger, mockDriver := newTransactionTestLogger(Config{
+		LogLevel:    DebugLevel,
+		DefaultTags: map[string]string{"environment": "test"},
+	})
+	slogger := slog.New(NewSlogHandler(logger))
+
+	slogger.With("service", "payments").WithGroup("http").Warn("slow request",
+		"status", 200,
+		slog.Duration("latency", time.Second),
+		slog.Group("client", "ip", "127.0.0.1"),
+		"err", errors.New("timeout"),
+	)
+
+	if len(mockDriver.logs) != 1 {
+		t.Fatalf("wanted 1 log, got %d", len(mockDriver.logs))
+	}
+
+	log := mockDriver.logs[0]
+	if log.Level != WarningLevel || log.Message != "slow request" {
+		t.Errorf("unexpected log: %v", log)
+	}
+
+	values := log.Values()
+	want := map[string]interface{}{
+		"environment":    "test",
+		"service":        "payments",
+		"http.status":    int64(200),
+		"http.latency":   float64(1000),
+		"http.client.ip": "127.0.0.1",
+		"http.err":       "timeout",
+	}
+	for key, value := range want {
+		if values[key] != value {
+			t.Errorf("wanted %s=%v, got %v", key, value, values[key])
+		}
+	}
+}
+
+func TestSlogLevels(t *testing.T) {
+	tests := []struct {
+		level slog.Level
+		want  LogLevel
+	}{
+		{slog.LevelDebug, DebugLevel},
+		{slog.LevelInfo, InfoLevel},
+		{slog.LevelInfo + 2, InfoLevel},
+		{slog.LevelWarn, WarningLevel},
+		{slog.LevelError, ErrorLevel},
+		{slog.LevelError + 4, ErrorLevel},
+	}
+
+	for _, tt := range tests {
+		if got := slogLevel(tt.level); got != tt.want {
+			t.Errorf("slog level %v: wanted %v, got %v", tt.level, tt.want, got)
+		}
+	}
+}
+
+func TestSlogEnabled(t *testing.T) {
+	logger, mockDriver := newTransactionTestLogger(Config{LogLevel: WarningLevel})
+	handler := NewSlogHandler(logger)
+
+	if handler.Enabled(context.Background(), slog.LevelInfo) {
+		t.Error("info shouldn't be enabled at warning level")
+	}
+
+	logger.SetLogLevel(InfoLevel)
+	if !handler.Enabled(context.Background(), slog.LevelInfo) {
+		t.Error("wanted info enabled after lowering the level")
+	}
+
+	slog.New(handler).Debug("hidden")
+	if len(mockDriver.logs) != 0 {
+		t.Errorf("wanted debug dropped, got %d logs", len(mockDriver.logs))
+	}
+}
+
+func TestSlogTransactionFromContext(t *testing.T) {
+	logger, mockDriver := newTransactionTestLogger(Config{LogLevel: DebugLevel})
+	ctx := ContextWithTransaction(context.Background(), "abc123")
+
+	slog.New(NewSlogHandler(logger)).InfoContext(ctx, "in transaction")
+
+	if len(mockDriver.logs) != 1 || mockDriver.logs[0].TransactionID != "abc123" {
+		t.Errorf("wanted transaction ID from context, got %v", mockDriver.logs)
+	}
+}
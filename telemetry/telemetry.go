@@ -1,33 +1,36 @@
 package telemetry
 
 import (
-	"crypto/rand"
 	"fmt"
+	"os"
 	"sync"
 	"time"
 )
 
-type LogLevel int
-
-const (
-	DebugLevel LogLevel = iota
-	InfoLevel
-	WarningLevel
-	ErrorLevel
-)
-
 type Logger struct {
 	driver       Driver
 	config       Config
 	transactions map[string]*Transaction
 	mutex        sync.Mutex
-}
+	pipeline     *pipeline
+	reaper       *reaper
+	sampler      *sampler
+	watcher      *watcher
+	errorHandler func(error)
 
-type Transaction struct {
-	ID    string
-	Start time.Time
-	End   time.Time
-	Logs  []Log
+	// reloadMutex serializes ApplyConfig and Close, which start and stop
+	// the reaper and sampler, swapMutex is held by the flusher while it
+	// writes so the driver isn't swapped under it
+	reloadMutex sync.Mutex
+	swapMutex   sync.RWMutex
+	closed      bool
+
+	// set on child loggers from Named and With, they only have their own
+	// name, tags and level and share everything else with the root
+	parent *Logger
+	name   string
+	tags   map[string]string
+	level  *LogLevel
 }
 
 type Log struct {
@@ -35,41 +38,178 @@ type Log struct {
 	Level         LogLevel
 	Message       string
 	Tags          map[string]string
+	Fields        Fields
 	TransactionID string
+	ParentID      string
+	TraceID       string
+	SpanID        string
+}
+
+// Values merges the string tags and typed fields into one map with JSON
+// ready values, fields win over tags with the same key.
+func (l Log) Values() map[string]interface{} {
+	values := make(map[string]interface{}, len(l.Tags)+len(l.Fields))
+	for key, value := range l.Tags {
+		values[key] = value
+	}
+	for _, field := range l.Fields {
+		values[field.Key] = field.JSONValue()
+	}
+	return values
 }
 
-func NewLogger(config Config) (*Logger, error) {
+func NewLogger(config Config, options ...Option) (*Logger, error) {
 	driver, err := getDriver(config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create logger: %v", err)
 	}
 
-	return &Logger{
+	logger := &Logger{
 		driver:       driver,
 		config:       config,
 		transactions: make(map[string]*Transaction),
-	}, nil
+	}
+
+	if config.Buffer != nil {
+		logger.pipeline = newPipeline(*config.Buffer, logger.writeBatch)
+	}
+
+	if config.Transactions.MaxAge > 0 {
+		logger.startReaper()
+	}
+
+	if config.Sampling != nil {
+		logger.startSampler(*config.Sampling)
+	}
+
+	for _, option := range options {
+		if err := option(logger); err != nil {
+			logger.Close()
+			return nil, fmt.Errorf("failed to create logger: %v", err)
+		}
+	}
+
+	return logger, nil
 }
 
+// Close drains the queue when buffering is enabled and then closes the
+// driver. Closing a child logger does nothing, the root owns the driver.
 func (l *Logger) Close() error {
-	return l.driver.Close()
+	if l.parent != nil {
+		return nil
+	}
+	// the watcher may be waiting for reloadMutex in ApplyConfig, so it is
+	// stopped first
+	l.stopWatcher()
+
+	l.reloadMutex.Lock()
+	defer l.reloadMutex.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+
+	l.stopReaper()
+	l.stopSampler()
+	if l.pipeline != nil {
+		l.pipeline.close()
+	}
+
+	l.mutex.Lock()
+	driver := l.driver
+	l.mutex.Unlock()
+	return driver.Close()
 }
 
-func (l *Logger) log(level LogLevel, message string, tags map[string]string, transactionID ...string) error {
+// SetErrorHandler sets the function that receives errors which can't be
+// returned to the caller, like driver errors from the background flusher.
+// By default they are written to stderr.
+func (l *Logger) SetErrorHandler(handler func(error)) {
+	l = l.root()
 	l.mutex.Lock()
 	defer l.mutex.Unlock()
+	l.errorHandler = handler
+}
+
+func (l *Logger) handleError(err error) {
+	l = l.root()
+	l.mutex.Lock()
+	handler := l.errorHandler
+	l.mutex.Unlock()
+
+	if handler == nil {
+		fmt.Fprintf(os.Stderr, "telemetry: %v\n", err)
+		return
+	}
+	handler(err)
+}
 
-	if level < l.config.LogLevel {
+func (l *Logger) log(level LogLevel, message string, tags map[string]string, fields []Field, transactionID ...string) error {
+	log, ok := l.newLog(level, message, tags, fields, transactionID...)
+	if !ok {
 		return nil
 	}
+	return l.write(log)
+}
+
+func (l *Logger) write(log Log) error {
+	l = l.root()
+	if l.pipeline != nil {
+		return l.pipeline.enqueue(log)
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.driver.Log(log)
+}
+
+func (l *Logger) enabled(level LogLevel) bool {
+	root := l.root()
+	root.mutex.Lock()
+	defer root.mutex.Unlock()
+	return level >= root.levelFor(l)
+}
+
+func (l *Logger) newLog(level LogLevel, message string, tags map[string]string, fields []Field, transactionID ...string) (Log, bool) {
+	root := l.root()
+	root.mutex.Lock()
+	defer root.mutex.Unlock()
+
+	var transaction *Transaction
+	if len(transactionID) == 1 {
+		transaction = root.transactions[transactionID[0]]
+		if transaction != nil {
+			transaction.record(level)
+		}
+	}
+
+	// with transaction buffering debug entries are held back regardless of
+	// the level, they are only sent if the transaction fails or is slow
+	buffering := transaction != nil && root.config.Transactions.Buffering
+	hold := buffering && level <= DebugLevel
 
-	count := len(tags) + len(l.config.DefaultTags)
+	if level < root.levelFor(l) && !hold {
+		return Log{}, false
+	}
+
+	count := len(tags) + len(root.config.DefaultTags) + len(l.tags)
+	if l.name != "" {
+		count++
+	}
 
 	var finalTags map[string]string
 	if count > 0 {
 		finalTags = make(map[string]string, count)
 
-		for k, v := range l.config.DefaultTags {
+		for k, v := range root.config.DefaultTags {
+			finalTags[k] = v
+		}
+
+		if l.name != "" {
+			finalTags["logger"] = l.name
+		}
+
+		for k, v := range l.tags {
 			finalTags[k] = v
 		}
 
@@ -83,79 +223,134 @@ func (l *Logger) log(level LogLevel, message string, tags map[string]string, tra
 		Level:         level,
 		Message:       message,
 		Tags:          finalTags,
+		Fields:        fields,
 		TransactionID: "",
 	}
 
 	if len(transactionID) == 1 {
 		log.TransactionID = transactionID[0]
 	}
+	if transaction != nil {
+		log.ParentID = transaction.ParentID
+		log.TraceID = transaction.TraceID
+		log.SpanID = transaction.SpanID
+	}
 
-	return l.driver.Log(log)
+	if buffering {
+		transaction.Logs = append(transaction.Logs, log)
+	}
+
+	if !hold && root.sampler != nil && !root.sampler.allow(log) {
+		return Log{}, false
+	}
+
+	return log, !hold
+}
+
+func (l *Logger) Trace(message string, tags map[string]string, transactionID ...string) error {
+	return l.log(TraceLevel, message, tags, nil, transactionID...)
+}
+
+func (l *Logger) TraceFields(message string, fields []Field, transactionID ...string) error {
+	return l.log(TraceLevel, message, nil, fields, transactionID...)
 }
 
 func (l *Logger) Debug(message string, tags map[string]string, transactionID ...string) error {
-	return l.log(DebugLevel, message, tags, transactionID...)
+	return l.log(DebugLevel, message, tags, nil, transactionID...)
+}
+
+func (l *Logger) DebugFields(message string, fields []Field, transactionID ...string) error {
+	return l.log(DebugLevel, message, nil, fields, transactionID...)
 }
 
 func (l *Logger) Info(message string, tags map[string]string, transactionID ...string) error {
-	return l.log(InfoLevel, message, tags, transactionID...)
+	return l.log(InfoLevel, message, tags, nil, transactionID...)
+}
+
+func (l *Logger) InfoFields(message string, fields []Field, transactionID ...string) error {
+	return l.log(InfoLevel, message, nil, fields, transactionID...)
 }
 
 func (l *Logger) Warning(message string, tags map[string]string, transactionID ...string) error {
-	return l.log(WarningLevel, message, tags, transactionID...)
+	return l.log(WarningLevel, message, tags, nil, transactionID...)
+}
+
+func (l *Logger) WarningFields(message string, fields []Field, transactionID ...string) error {
+	return l.log(WarningLevel, message, nil, fields, transactionID...)
 }
 
 func (l *Logger) Error(message string, tags map[string]string, transactionID ...string) error {
-	return l.log(ErrorLevel, message, tags, transactionID...)
+	return l.log(ErrorLevel, message, tags, nil, transactionID...)
 }
 
-func (l *Logger) SetLogLevel(level LogLevel) {
-	l.mutex.Lock()
-	defer l.mutex.Unlock()
-	l.config.LogLevel = level
+func (l *Logger) ErrorFields(message string, fields []Field, transactionID ...string) error {
+	return l.log(ErrorLevel, message, nil, fields, transactionID...)
 }
 
-func (l *Logger) AddDefaultTag(key, value string) {
-	l.mutex.Lock()
-	defer l.mutex.Unlock()
-	l.config.DefaultTags[key] = value
+// Panic logs at panic level and then panics with the message.
+func (l *Logger) Panic(message string, tags map[string]string, transactionID ...string) {
+	l.panic(message, tags, nil, transactionID...)
 }
 
-func (l *Logger) DeleteDefaultTag(key string) {
-	l.mutex.Lock()
-	defer l.mutex.Unlock()
-	delete(l.config.DefaultTags, key)
+func (l *Logger) PanicFields(message string, fields []Field, transactionID ...string) {
+	l.panic(message, nil, fields, transactionID...)
 }
 
-func (l *Logger) StartTransaction() string {
-	transactionID := generateTransactionID()
-	l.mutex.Lock()
-	defer l.mutex.Unlock()
-	l.transactions[transactionID] = &Transaction{
-		ID:    transactionID,
-		Start: time.Now(),
+func (l *Logger) panic(message string, tags map[string]string, fields []Field, transactionID ...string) {
+	if err := l.log(PanicLevel, message, tags, fields, transactionID...); err != nil {
+		l.handleError(err)
+	}
+	panic(message)
+}
+
+// Fatal logs at fatal level, then closes the logger so buffered entries are
+// flushed and the driver is closed, and exits with status 1.
+func (l *Logger) Fatal(message string, tags map[string]string, transactionID ...string) {
+	l.fatal(message, tags, nil, transactionID...)
+}
+
+func (l *Logger) FatalFields(message string, fields []Field, transactionID ...string) {
+	l.fatal(message, nil, fields, transactionID...)
+}
+
+func (l *Logger) fatal(message string, tags map[string]string, fields []Field, transactionID ...string) {
+	if err := l.log(FatalLevel, message, tags, fields, transactionID...); err != nil {
+		l.handleError(err)
+	}
+	// Close does nothing on child loggers, the root owns the buffer and driver
+	if err := l.root().Close(); err != nil {
+		l.handleError(err)
 	}
-	return transactionID
+	exit(1)
 }
 
-func (l *Logger) EndTransaction(transactionID string) error {
+// SetLogLevel sets the minimum level. On a child logger it only applies to
+// the child and the children created from it afterwards.
+func (l *Logger) SetLogLevel(level LogLevel) {
+	root := l.root()
+	root.mutex.Lock()
+	defer root.mutex.Unlock()
+
+	if l.parent != nil {
+		l.level = &level
+		return
+	}
+	l.config.LogLevel = level
+}
+
+func (l *Logger) AddDefaultTag(key, value string) {
+	l = l.root()
 	l.mutex.Lock()
 	defer l.mutex.Unlock()
-	transaction, exists := l.transactions[transactionID]
-	if !exists {
-		return fmt.Errorf("endtransaction %s doesnt exist", transactionID)
+	if l.config.DefaultTags == nil {
+		l.config.DefaultTags = make(map[string]string)
 	}
-	transaction.End = time.Now()
-	delete(l.transactions, transactionID)
-	// maybe log a summary or smth on how lnog it took etc, easier for kibana etc
-	return nil
+	l.config.DefaultTags[key] = value
 }
 
-func generateTransactionID() string {
-	b := make([]byte, 16)
-	_, err := rand.Read(b)
-	if err != nil {
-		return fmt.Sprintf("%d", time.Now().UnixNano())
-	}
-	return fmt.Sprintf("%x", b)
+func (l *Logger) DeleteDefaultTag(key string) {
+	l = l.root()
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	delete(l.config.DefaultTags, key)
 }
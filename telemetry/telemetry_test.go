@@ -150,6 +150,12 @@ func TestDefaultTags(t *testing.T) {
 	if _, exists := logger.config.DefaultTags["app_name"]; exists {
 		t.Error("wanted default tag deleted, still exists")
 	}
+
+	logger.config.DefaultTags = nil
+	logger.AddDefaultTag("app_name", "telemetry")
+	if logger.config.DefaultTags["app_name"] != "telemetry" {
+		t.Error("wanted default tag added to a config without default tags")
+	}
 }
 
 func TestUniqueTransactions(t *testing.T) {
@@ -0,0 +1,153 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// tomlToJSON converts a TOML document to JSON. Dates and times have no JSON
+// type, they become strings in RFC 3339 form.
+func tomlToJSON(data []byte) ([]byte, error) {
+	var document map[string]any
+	metadata, err := toml.Decode(string(data), &document)
+	if err != nil {
+		return nil, &ConfigError{Message: err.Error()}
+	}
+	if err := checkTOMLTables(string(data), metadata); err != nil {
+		return nil, err
+	}
+
+	value, err := tomlValue(document, "")
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+func tomlValue(value any, path string) (any, error) {
+	switch value := value.(type) {
+	case map[string]any:
+		for _, key := range objectKeys(value) {
+			child, err := tomlValue(value[key], keyPath(path, key))
+			if err != nil {
+				return nil, err
+			}
+			value[key] = child
+		}
+		return value, nil
+	case []map[string]any:
+		array := make([]any, len(value))
+		for i, table := range value {
+			child, err := tomlValue(table, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			array[i] = child
+		}
+		return array, nil
+	case []any:
+		for i, item := range value {
+			child, err := tomlValue(item, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			value[i] = child
+		}
+		return value, nil
+	case float64:
+		if math.IsInf(value, 0) || math.IsNaN(value) {
+			return nil, &ConfigError{Path: path, Message: "toml: inf and nan can't be represented in JSON"}
+		}
+	case time.Time:
+		// the decoder marks local dates and times with these zones
+		switch value.Location().String() {
+		case "date-local":
+			return value.Format("2006-01-02"), nil
+		case "time-local":
+			return value.Format("15:04:05.999999999"), nil
+		case "datetime-local":
+			return value.Format("2006-01-02T15:04:05.999999999"), nil
+		}
+		return value.Format(time.RFC3339Nano), nil
+	}
+	return value, nil
+}
+
+// checkTOMLTables reports tables that are created by dotted keys and
+// defined again with a [table] header, or the other way round. The TOML
+// spec forbids both, but the decoder merges them. The keys are in the
+// order of the document, headers and inline tables are "Hash" keys.
+func checkTOMLTables(text string, metadata toml.MetaData) error {
+	explicit := make(map[string]bool)
+	dotted := make(map[string]bool)
+	var opened []toml.Key
+
+	for _, key := range metadata.Keys() {
+		name := tomlKeyName(key)
+
+		switch metadata.Type(key...) {
+		case "Hash", "ArrayHash":
+			if dotted[name] {
+				return &ConfigError{Message: fmt.Sprintf("toml: line %d: table %s is already defined by dotted keys", tomlHeaderLine(text, key), key)}
+			}
+			if metadata.Type(key...) == "ArrayHash" {
+				// every [[table]] starts a new element with its own tables
+				for table := range explicit {
+					if strings.HasPrefix(table, name+"\x00") {
+						delete(explicit, table)
+					}
+				}
+				for table := range dotted {
+					if strings.HasPrefix(table, name+"\x00") {
+						delete(dotted, table)
+					}
+				}
+			}
+			explicit[name] = true
+			opened = append(opened, key)
+		default:
+			// the key is in the last opened table it starts with, the
+			// tables between that one and the key are created by the dots
+			parent := 0
+			for i := len(opened) - 1; i >= 0; i-- {
+				if len(opened[i]) < len(key) && tomlKeyName(key[:len(opened[i])]) == tomlKeyName(opened[i]) {
+					parent = len(opened[i])
+					break
+				}
+			}
+			for n := parent + 1; n < len(key); n++ {
+				table := tomlKeyName(key[:n])
+				if explicit[table] {
+					return &ConfigError{Message: fmt.Sprintf("toml: table %s is already defined and can't be extended by the dotted key %s", key[:n], key)}
+				}
+				dotted[table] = true
+			}
+		}
+	}
+	return nil
+}
+
+func tomlKeyName(key toml.Key) string {
+	return strings.Join(key, "\x00")
+}
+
+// tomlHeaderLine finds the line of the [table] or [[table]] header of key.
+func tomlHeaderLine(text string, key toml.Key) int {
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "[") {
+			continue
+		}
+		var header map[string]any
+		metadata, err := toml.Decode(line, &header)
+		if err == nil && len(metadata.Keys()) > 0 && tomlKeyName(metadata.Keys()[0]) == tomlKeyName(key) {
+			return i + 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,135 @@
+package telemetry
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTOMLToJSON(t *testing.T) {
+	document := `
+# telemetry config
+driver = "multi"
+log_level = "info"
+"quoted key" = 'C:\logs'
+started = 1979-05-27 07:32:00Z
+size = 1_000
+mask = 0xff
+ratio = 0.5e1
+multiline = """
+first \
+  second"""
+
+[default_tags]
+app_version = "1.0.0"
+note = "say \"hi\"\t\u00e9"
+
+[transactions]
+buffering = true
+latency_threshold = "500ms" # inline comment
+
+[[driver_config.drivers]]
+driver = "console"
+driver_config = { color = "never", layout = "time level message" }
+log_level = "debug"
+
+[[driver_config.drivers]]
+driver = "elasticsearch"
+log_level = "warning"
+
+[driver_config.drivers.driver_config]
+host = "http://localhost:9200"
+ports = [
+  9200,
+  9300, # trailing comma
+]
+`
+	data, err := tomlToJSON([]byte(document))
+	if err != nil {
+		t.Fatalf("tomltojson returned error: %v", err)
+	}
+
+	want := decodeJSON(t, []byte(`{
+		"driver": "multi",
+		"log_level": "info",
+		"quoted key": "C:\\logs",
+		"started": "1979-05-27T07:32:00Z",
+		"size": 1000,
+		"mask": 255,
+		"ratio": 5,
+		"multiline": "first second",
+		"default_tags": {"app_version": "1.0.0", "note": "say \"hi\"\té"},
+		"transactions": {"buffering": true, "latency_threshold": "500ms"},
+		"driver_config": {"drivers": [
+			{"driver": "console", "driver_config": {"color": "never", "layout": "time level message"}, "log_level": "debug"},
+			{"driver": "elasticsearch", "log_level": "warning", "driver_config": {"host": "http://localhost:9200", "ports": [9200, 9300]}}
+		]}
+	}`))
+	if got := decodeJSON(t, data); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected conversion\n got: %v\nwant: %v", got, want)
+	}
+}
+
+func TestTOMLErrors(t *testing.T) {
+	tests := map[string]string{
+		"a = 1\na = 2":               "line 2 (last key \"a\"): Key 'a' has already been defined",
+		"[a]\nb = 1\n[a]":            "line 3: Key 'a' has already been defined",
+		"a = 1\n[a]":                 "line 2: Key 'a' has already been defined",
+		"a.b.c = 1\n[a]\nx = 1":      "line 2: table a is already defined by dotted keys",
+		"[x]\na.b = 1\n[x.a]":        "line 3: table x.a is already defined by dotted keys",
+		"[a.b]\nc = 1\n[a]\nb.d = 1": "table a.b is already defined and can't be extended by the dotted key a.b.d",
+		"a = 1 b = 2":                "line 1: expected a top-level item to end with a newline",
+		"a = 007":                    "line 1 (last key \"a\"): Invalid integer \"007\"",
+		"a = \"bad \\q escape\"":     "line 1 (last key \"a\"): invalid escape in string",
+		"= 1":                        "line 1: unexpected '='",
+	}
+	for document, want := range tests {
+		_, err := tomlToJSON([]byte(document))
+		var configErr *ConfigError
+		if !errors.As(err, &configErr) || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: wanted config error containing %q, got %v", document, want, err)
+		}
+	}
+
+	_, err := tomlToJSON([]byte("[limits]\nrate = inf"))
+	if err == nil || err.Error() != "limits.rate: toml: inf and nan can't be represented in JSON" {
+		t.Errorf("wanted error for inf, got %v", err)
+	}
+}
+
+func TestTOMLTables(t *testing.T) {
+	document := `
+[fruit]
+apple.color = "red"
+apple.taste.sweet = true
+
+[fruit.apple.texture]
+smooth = true
+
+[[e]]
+g.h = 1
+
+[[e]]
+[e.g]
+h = 2
+
+[a.b]
+c = 1
+[a]
+d = { e.f = 1 }
+local = 1979-05-27
+`
+	data, err := tomlToJSON([]byte(document))
+	if err != nil {
+		t.Fatalf("tomltojson returned error: %v", err)
+	}
+	want := decodeJSON(t, []byte(`{
+		"fruit": {"apple": {"color": "red", "taste": {"sweet": true}, "texture": {"smooth": true}}},
+		"e": [{"g": {"h": 1}}, {"g": {"h": 2}}],
+		"a": {"b": {"c": 1}, "d": {"e": {"f": 1}}, "local": "1979-05-27"}
+	}`))
+	if got := decodeJSON(t, data); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected conversion\n got: %v\nwant: %v", got, want)
+	}
+}
@@ -0,0 +1,225 @@
+package telemetry
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	traceparentHeader  = "Traceparent"
+	tracestateHeader   = "Tracestate"
+	b3Header           = "B3"
+	b3TraceIDHeader    = "X-B3-Traceid"
+	b3SpanIDHeader     = "X-B3-Spanid"
+	b3ParentSpanHeader = "X-B3-Parentspanid"
+	b3SampledHeader    = "X-B3-Sampled"
+	b3FlagsHeader      = "X-B3-Flags"
+)
+
+// remoteParent is the caller's span, as read from incoming headers.
+type remoteParent struct {
+	traceID    string
+	spanID     string
+	traceState string
+	sampled    bool
+}
+
+// StartTransactionFromHeaders continues the trace of an incoming request.
+// It reads W3C traceparent/tracestate headers, then B3 single and B3 multi
+// headers. The transaction ID is the incoming trace ID, so it matches the
+// trace IDs of the rest of the stack, and ParentID is the caller's span.
+// If there are no valid headers a fresh transaction is started.
+func (l *Logger) StartTransactionFromHeaders(header http.Header) string {
+	l = l.root()
+	parent, ok := parseTraceHeaders(header)
+	if !ok {
+		return l.StartTransaction()
+	}
+
+	transaction := &Transaction{
+		ID:         parent.traceID,
+		ParentID:   parent.spanID,
+		TraceID:    parent.traceID,
+		SpanID:     generateSpanID(),
+		TraceState: parent.traceState,
+		Sampled:    parent.sampled,
+		Start:      time.Now(),
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// a trace can come through the same service more than once, the
+	// transaction ID has to stay unique though
+	if _, exists := l.transactions[transaction.ID]; exists {
+		transaction.ID = generateTransactionID()
+	}
+	l.transactions[transaction.ID] = transaction
+	return transaction.ID
+}
+
+// InjectHeaders writes the trace context of the transaction onto outgoing
+// request headers, both as W3C traceparent/tracestate and as B3.
+func (l *Logger) InjectHeaders(transactionID string, header http.Header) error {
+	l = l.root()
+	l.mutex.Lock()
+	transaction, ok := l.transactions[transactionID]
+	l.mutex.Unlock()
+	if !ok {
+		return fmt.Errorf("injectheaders %s doesnt exist", transactionID)
+	}
+
+	traceID := transaction.TraceID
+	if !validHex(traceID, 32) {
+		// nested inside an ID that isn't a trace ID, start a trace here
+		traceID = transaction.ID
+	}
+	if !validHex(traceID, 32) {
+		return fmt.Errorf("transaction %s has no valid trace ID", transactionID)
+	}
+
+	flags, sampled := "00", "0"
+	if transaction.Sampled {
+		flags, sampled = "01", "1"
+	}
+
+	header.Set(traceparentHeader, fmt.Sprintf("00-%s-%s-%s", traceID, transaction.SpanID, flags))
+	if transaction.TraceState != "" {
+		header.Set(tracestateHeader, transaction.TraceState)
+	}
+	header.Set(b3Header, fmt.Sprintf("%s-%s-%s", traceID, transaction.SpanID, sampled))
+	header.Set(b3TraceIDHeader, traceID)
+	header.Set(b3SpanIDHeader, transaction.SpanID)
+	header.Set(b3SampledHeader, sampled)
+	return nil
+}
+
+func parseTraceHeaders(header http.Header) (remoteParent, bool) {
+	if parent, ok := parseTraceparent(header.Get(traceparentHeader)); ok {
+		parent.traceState = strings.Join(header.Values(tracestateHeader), ",")
+		return parent, true
+	}
+	if parent, ok := parseB3Single(header.Get(b3Header)); ok {
+		return parent, true
+	}
+	return parseB3Multi(header)
+}
+
+// parseTraceparent parses version-traceid-parentid-flags, later versions
+// may append more fields which are ignored.
+func parseTraceparent(value string) (remoteParent, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 {
+		return remoteParent{}, false
+	}
+
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+	if !validHex(version, 2) || version == "ff" || (version == "00" && len(parts) != 4) {
+		return remoteParent{}, false
+	}
+	if !validID(traceID, 32) || !validID(spanID, 16) || !validHex(flags, 2) {
+		return remoteParent{}, false
+	}
+
+	return remoteParent{
+		traceID: traceID,
+		spanID:  spanID,
+		sampled: hexDigit(flags[1])&1 == 1,
+	}, true
+}
+
+// parseB3Single parses traceid-spanid[-sampled[-parentspanid]].
+func parseB3Single(value string) (remoteParent, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 2 || len(parts) > 4 {
+		return remoteParent{}, false
+	}
+
+	parent := remoteParent{traceID: padTraceID(parts[0]), spanID: parts[1], sampled: true}
+	if len(parts) > 2 {
+		sampled, ok := parseB3Sampled(parts[2])
+		if !ok {
+			return remoteParent{}, false
+		}
+		parent.sampled = sampled
+	}
+	if len(parts) == 4 && !validID(parts[3], 16) {
+		return remoteParent{}, false
+	}
+
+	if !validID(parent.traceID, 32) || !validID(parent.spanID, 16) {
+		return remoteParent{}, false
+	}
+	return parent, true
+}
+
+func parseB3Multi(header http.Header) (remoteParent, bool) {
+	parent := remoteParent{
+		traceID: padTraceID(header.Get(b3TraceIDHeader)),
+		spanID:  header.Get(b3SpanIDHeader),
+		sampled: true,
+	}
+	if !validID(parent.traceID, 32) || !validID(parent.spanID, 16) {
+		return remoteParent{}, false
+	}
+
+	if header.Get(b3FlagsHeader) == "1" {
+		return parent, true
+	}
+	if value := header.Get(b3SampledHeader); value != "" {
+		sampled, ok := parseB3Sampled(value)
+		if !ok {
+			return remoteParent{}, false
+		}
+		parent.sampled = sampled
+	}
+	return parent, true
+}
+
+func parseB3Sampled(value string) (bool, bool) {
+	switch value {
+	case "1", "d", "true":
+		return true, true
+	case "0", "false":
+		return false, true
+	}
+	return false, false
+}
+
+// padTraceID widens 64 bit B3 trace IDs to the 128 bits W3C uses.
+func padTraceID(traceID string) string {
+	traceID = strings.ToLower(traceID)
+	if len(traceID) == 16 {
+		return strings.Repeat("0", 16) + traceID
+	}
+	return traceID
+}
+
+// validID is a lowercase hex ID of the given length that isn't all zeros.
+func validID(id string, length int) bool {
+	return validHex(id, length) && strings.Trim(id, "0") != ""
+}
+
+func validHex(value string, length int) bool {
+	if len(value) != length {
+		return false
+	}
+	for i := 0; i < len(value); i++ {
+		if hexDigit(value[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func hexDigit(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'a' && c <= 'f':
+		return int(c-'a') + 10
+	}
+	return -1
+}
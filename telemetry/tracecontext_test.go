@@ -0,0 +1,134 @@
+package telemetry
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseTraceHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		ok      bool
+		traceID string
+		spanID  string
+		sampled bool
+	}{
+		{
+			name:    "traceparent",
+			headers: map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+			ok:      true, traceID: "4bf92f3577b34da6a3ce929d0e0e4736", spanID: "00f067aa0ba902b7", sampled: true,
+		},
+		{
+			name:    "traceparent not sampled",
+			headers: map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"},
+			ok:      true, traceID: "4bf92f3577b34da6a3ce929d0e0e4736", spanID: "00f067aa0ba902b7", sampled: false,
+		},
+		{
+			name:    "future traceparent version",
+			headers: map[string]string{"traceparent": "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"},
+			ok:      true, traceID: "4bf92f3577b34da6a3ce929d0e0e4736", spanID: "00f067aa0ba902b7", sampled: true,
+		},
+		{
+			name:    "b3 single",
+			headers: map[string]string{"b3": "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1-05e3ac9a4f6e3b90"},
+			ok:      true, traceID: "80f198ee56343ba864fe8b2a57d3eff7", spanID: "e457b5a2e4d86bd1", sampled: true,
+		},
+		{
+			name:    "b3 multi with 64 bit trace ID",
+			headers: map[string]string{"X-B3-TraceId": "A3CE929D0E0E4736", "X-B3-SpanId": "00f067aa0ba902b7", "X-B3-Sampled": "0"},
+			ok:      true, traceID: "0000000000000000a3ce929d0e0e4736", spanID: "00f067aa0ba902b7", sampled: false,
+		},
+		{name: "all zero trace ID", headers: map[string]string{"traceparent": "00-00000000000000000000000000000000-00f067aa0ba902b7-01"}},
+		{name: "uppercase traceparent", headers: map[string]string{"traceparent": "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"}},
+		{name: "version ff", headers: map[string]string{"traceparent": "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}},
+		{name: "b3 sampling only", headers: map[string]string{"b3": "1"}},
+		{name: "garbage", headers: map[string]string{"traceparent": "nope", "b3": "also-nope"}},
+		{name: "none", headers: map[string]string{}},
+	}
+
+	for _, tt := range tests {
+		header := http.Header{}
+		for key, value := range tt.headers {
+			header.Set(key, value)
+		}
+
+		parent, ok := parseTraceHeaders(header)
+		if ok != tt.ok {
+			t.Errorf("%s: wanted ok=%v, got %v", tt.name, tt.ok, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if parent.traceID != tt.traceID || parent.spanID != tt.spanID || parent.sampled != tt.sampled {
+			t.Errorf("%s: unexpected parent %+v", tt.name, parent)
+		}
+	}
+}
+
+func TestStartTransactionFromHeaders(t *testing.T) {
+	logger, mockDriver := newTransactionTestLogger(Config{LogLevel: DebugLevel})
+
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	header.Set("tracestate", "congo=t61rcWkgMzE")
+
+	transactionID := logger.StartTransactionFromHeaders(header)
+	if transactionID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("wanted transaction ID to be the trace ID, got %s", transactionID)
+	}
+
+	logger.Info("continued", nil, transactionID)
+	if log := mockDriver.logs[0]; log.TraceID != transactionID || log.ParentID != "00f067aa0ba902b7" {
+		t.Errorf("wanted trace and remote parent on log, got %+v", log)
+	}
+
+	if second := logger.StartTransactionFromHeaders(header); second == transactionID {
+		t.Error("wanted a unique transaction ID when the trace is already open")
+	}
+
+	if fresh := logger.StartTransactionFromHeaders(http.Header{"Traceparent": {"invalid"}}); len(fresh) != 32 {
+		t.Errorf("wanted a fresh transaction for invalid headers, got %s", fresh)
+	}
+}
+
+func TestInjectHeaders(t *testing.T) {
+	logger, _ := newTransactionTestLogger(Config{LogLevel: DebugLevel})
+
+	incoming := http.Header{}
+	incoming.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	incoming.Set("tracestate", "congo=t61rcWkgMzE")
+	root := logger.StartTransactionFromHeaders(incoming)
+	child := logger.StartTransaction(root)
+
+	outgoing := http.Header{}
+	if err := logger.InjectHeaders(child, outgoing); err != nil {
+		t.Fatalf("injectheaders returned error: %v", err)
+	}
+
+	spanID := logger.transactions[child].SpanID
+	want := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + spanID + "-01"
+	if got := outgoing.Get("traceparent"); got != want {
+		t.Errorf("wanted traceparent %s, got %s", want, got)
+	}
+	if outgoing.Get("tracestate") != "congo=t61rcWkgMzE" {
+		t.Errorf("wanted tracestate passed on, got %s", outgoing.Get("tracestate"))
+	}
+	if !strings.HasPrefix(outgoing.Get("b3"), "4bf92f3577b34da6a3ce929d0e0e4736-"+spanID) {
+		t.Errorf("unexpected b3 header %s", outgoing.Get("b3"))
+	}
+	if outgoing.Get("X-B3-TraceId") != "4bf92f3577b34da6a3ce929d0e0e4736" || outgoing.Get("X-B3-Sampled") != "1" {
+		t.Errorf("unexpected b3 multi headers %v", outgoing)
+	}
+
+	// what we send has to be readable by the next service
+	if parent, ok := parseTraceHeaders(outgoing); !ok || parent.spanID != spanID {
+		t.Errorf("wanted injected headers to parse back, got %+v", parent)
+	}
+
+	if err := logger.InjectHeaders("missing", http.Header{}); err == nil {
+		t.Error("wanted error for unknown transaction")
+	}
+}
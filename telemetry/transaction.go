@@ -0,0 +1,302 @@
+package telemetry
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const defaultSummaryLevel = InfoLevel
+
+// errTransactionNotFound is returned when ending a transaction that isn't
+// open, like one that was already ended or reaped.
+var errTransactionNotFound = errors.New("doesnt exist")
+
+// TransactionConfig controls how transactions are reported. With Buffering
+// on, entries logged with a transaction ID are kept in Transaction.Logs and
+// debug entries are only sent when the transaction ends in an error, with
+// an "outcome" tag of "failure" or "error", or took longer than
+// LatencyThreshold.
+//
+// Transactions open for longer than MaxAge are ended by a background reaper
+// every ReapInterval, which defaults to half of MaxAge.
+type TransactionConfig struct {
+	SummaryLevel     *LogLevel    `json:"summary_level,omitempty"`
+	Buffering        bool         `json:"buffering"`
+	LatencyThreshold JSONDuration `json:"latency_threshold"`
+	MaxAge           JSONDuration `json:"max_age"`
+	ReapInterval     JSONDuration `json:"reap_interval"`
+}
+
+// Transaction is a unit of work, like an HTTP request or a database call
+// inside of it. Nested transactions point to their parent through ParentID
+// and share the TraceID of the root transaction.
+//
+// SpanID, TraceState and Sampled are what is sent in trace context headers,
+// see InjectHeaders.
+type Transaction struct {
+	ID         string
+	ParentID   string
+	TraceID    string
+	SpanID     string
+	TraceState string
+	Sampled    bool
+	Start      time.Time
+	End        time.Time
+	Logs       []Log
+	Counts     map[LogLevel]int
+	MaxLevel   LogLevel
+	children   map[string]struct{}
+}
+
+func (t *Transaction) record(level LogLevel) {
+	if t.Counts == nil {
+		t.Counts = make(map[LogLevel]int)
+	}
+	if len(t.Counts) == 0 || level > t.MaxLevel {
+		t.MaxLevel = level
+	}
+	t.Counts[level]++
+}
+
+// StartTransaction starts a transaction. When a parent transaction ID is
+// given the new one is nested inside of it and joins its trace.
+func (l *Logger) StartTransaction(parentID ...string) string {
+	l = l.root()
+	transactionID := generateTransactionID()
+	transaction := &Transaction{
+		ID:      transactionID,
+		TraceID: transactionID,
+		SpanID:  generateSpanID(),
+		Sampled: true,
+		Start:   time.Now(),
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if len(parentID) == 1 && parentID[0] != "" {
+		transaction.ParentID = parentID[0]
+		transaction.TraceID = parentID[0]
+		if parent, ok := l.transactions[parentID[0]]; ok {
+			transaction.TraceID = parent.TraceID
+			transaction.TraceState = parent.TraceState
+			transaction.Sampled = parent.Sampled
+			if parent.children == nil {
+				parent.children = make(map[string]struct{})
+			}
+			parent.children[transactionID] = struct{}{}
+		}
+	}
+
+	l.transactions[transactionID] = transaction
+	return transactionID
+}
+
+func (l *Logger) EndTransaction(transactionID string) error {
+	return l.EndTransactionWithTags(transactionID, nil)
+}
+
+// EndTransactionWithTags ends the transaction and logs a summary with its
+// duration and how many entries were logged per level. The tags are added
+// to the summary, use them for the outcome, like {"outcome": "failure"}.
+// Nested transactions that are still open are listed in the summary.
+func (l *Logger) EndTransactionWithTags(transactionID string, tags map[string]string) error {
+	return l.endTransaction(transactionID, tags, false)
+}
+
+func (l *Logger) endTransaction(transactionID string, tags map[string]string, timedOut bool) error {
+	l = l.root()
+	l.mutex.Lock()
+	transaction, exists := l.transactions[transactionID]
+	if !exists {
+		l.mutex.Unlock()
+		return fmt.Errorf("endtransaction %s %w", transactionID, errTransactionNotFound)
+	}
+	transaction.End = time.Now()
+	delete(l.transactions, transactionID)
+	if parent, ok := l.transactions[transaction.ParentID]; ok {
+		delete(parent.children, transactionID)
+	}
+	openChildren := make([]string, 0, len(transaction.children))
+	for child := range transaction.children {
+		openChildren = append(openChildren, child)
+	}
+
+	level := defaultSummaryLevel
+	if l.config.Transactions.SummaryLevel != nil {
+		level = *l.config.Transactions.SummaryLevel
+	}
+	message := "transaction finished"
+	if timedOut {
+		level = WarningLevel
+		message = "transaction timed out"
+		tags = mergeTags(tags, map[string]string{"timed_out": "true"})
+	}
+	buffering := l.config.Transactions.Buffering
+	threshold := time.Duration(l.config.Transactions.LatencyThreshold)
+	l.mutex.Unlock()
+
+	summary := transaction.summary()
+	if buffering {
+		released := transaction.failed(tags) || (threshold > 0 && transaction.End.Sub(transaction.Start) > threshold)
+		if released {
+			if err := l.release(transaction); err != nil {
+				return err
+			}
+		}
+		summary = append(summary, Bool("debug_released", released))
+	}
+	if len(openChildren) > 0 {
+		sort.Strings(openChildren)
+		summary = append(summary, Int("open_children", len(openChildren)), String("open_children_ids", strings.Join(openChildren, ",")))
+	}
+
+	log, ok := l.newLog(level, message, tags, summary, transactionID)
+	if !ok {
+		return nil
+	}
+	// the transaction is already gone from l.transactions, so newLog
+	// couldn't fill in its IDs
+	log.ParentID = transaction.ParentID
+	log.TraceID = transaction.TraceID
+	log.SpanID = transaction.SpanID
+	return l.write(log)
+}
+
+func (t *Transaction) failed(tags map[string]string) bool {
+	if len(t.Counts) > 0 && t.MaxLevel >= ErrorLevel {
+		return true
+	}
+	outcome := tags["outcome"]
+	return outcome == "failure" || outcome == "error" || tags["timed_out"] == "true"
+}
+
+// OpenTransactions returns how many transactions are currently open.
+func (l *Logger) OpenTransactions() int {
+	l = l.root()
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return len(l.transactions)
+}
+
+type reaper struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+func (l *Logger) startReaper() {
+	maxAge := time.Duration(l.config.Transactions.MaxAge)
+	interval := time.Duration(l.config.Transactions.ReapInterval)
+	if interval <= 0 {
+		interval = maxAge / 2
+	}
+
+	l.reaper = &reaper{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(l.reaper.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				l.reap(maxAge)
+			case <-l.reaper.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (l *Logger) stopReaper() {
+	if l.reaper == nil {
+		return
+	}
+	select {
+	case <-l.reaper.stop:
+	default:
+		close(l.reaper.stop)
+	}
+	<-l.reaper.done
+}
+
+// reap ends transactions that are older than maxAge, like the ones of a
+// request handler that panicked before it could end its transaction.
+func (l *Logger) reap(maxAge time.Duration) {
+	cutoff := time.Now().Add(-maxAge)
+
+	l.mutex.Lock()
+	var stale []string
+	for id, transaction := range l.transactions {
+		if transaction.Start.Before(cutoff) {
+			stale = append(stale, id)
+		}
+	}
+	l.mutex.Unlock()
+
+	for _, id := range stale {
+		// the transaction may have been ended in the meantime
+		err := l.endTransaction(id, nil, true)
+		if err != nil && !errors.Is(err, errTransactionNotFound) {
+			l.handleError(err)
+		}
+	}
+}
+
+// release sends the debug entries that were held back.
+func (l *Logger) release(transaction *Transaction) error {
+	for _, log := range transaction.Logs {
+		if log.Level > DebugLevel {
+			continue
+		}
+		if err := l.write(log); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Transaction) summary() []Field {
+	fields := []Field{
+		Time("start", t.Start),
+		Time("end", t.End),
+		Float("duration_ms", float64(t.End.Sub(t.Start))/float64(time.Millisecond)),
+	}
+	// the levels added later are only counted when they were used
+	for level := TraceLevel; level <= FatalLevel; level++ {
+		if level >= DebugLevel && level <= ErrorLevel || t.Counts[level] > 0 {
+			fields = append(fields, Int("entries."+level.String(), t.Counts[level]))
+		}
+	}
+	if len(t.Counts) > 0 {
+		fields = append(fields, String("max_level", t.MaxLevel.String()))
+	}
+	return fields
+}
+
+func generateTransactionID() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return fmt.Sprintf("%x", b)
+}
+
+func generateSpanID() string {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		return fmt.Sprintf("%016x", time.Now().UnixNano())
+	}
+	return fmt.Sprintf("%x", b)
+}
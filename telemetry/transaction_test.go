@@ -0,0 +1,294 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTransactionTestLogger(config Config) (*Logger, *MockDriver) {
+	mockDriver := &MockDriver{}
+	return &Logger{
+		driver:       mockDriver,
+		config:       config,
+		transactions: make(map[string]*Transaction),
+	}, mockDriver
+}
+
+func TestTransactionSummary(t *testing.T) {
+	logger, mockDriver := newTransactionTestLogger(Config{
+		LogLevel:    InfoLevel,
+		DefaultTags: map[string]string{"environment": "test"},
+	})
+
+	transactionID := logger.StartTransaction()
+	logger.Debug("below level but counted", nil, transactionID)
+	logger.Info("one", nil, transactionID)
+	logger.Info("two", nil, transactionID)
+	logger.Warning("three", nil, transactionID)
+	logger.Error("not in transaction", nil)
+	time.Sleep(10 * time.Millisecond)
+
+	err := logger.EndTransactionWithTags(transactionID, map[string]string{"outcome": "success"})
+	if err != nil {
+		t.Fatalf("endtransaction returned error: %v", err)
+	}
+
+	summary := mockDriver.logs[len(mockDriver.logs)-1]
+	if summary.Level != InfoLevel || summary.TransactionID != transactionID {
+		t.Errorf("unexpected summary: %v", summary)
+	}
+
+	values := summary.Values()
+	want := map[string]interface{}{
+		"entries.debug":   int64(1),
+		"entries.info":    int64(2),
+		"entries.warning": int64(1),
+		"entries.error":   int64(0),
+		"max_level":       "warning",
+		"outcome":         "success",
+		"environment":     "test",
+	}
+	for key, value := range want {
+		if values[key] != value {
+			t.Errorf("wanted %s=%v, got %v", key, value, values[key])
+		}
+	}
+	if duration, _ := values["duration_ms"].(float64); duration < 10 {
+		t.Errorf("wanted duration of at least 10ms, got %v", values["duration_ms"])
+	}
+	if _, ok := values["start"]; !ok {
+		t.Error("wanted start in summary")
+	}
+}
+
+func TestTransactionSummaryLevel(t *testing.T) {
+	level := DebugLevel
+	logger, mockDriver := newTransactionTestLogger(Config{
+		LogLevel:     InfoLevel,
+		Transactions: TransactionConfig{SummaryLevel: &level},
+	})
+
+	transactionID := logger.StartTransaction()
+	if err := logger.EndTransaction(transactionID); err != nil {
+		t.Fatalf("endtransaction returned error: %v", err)
+	}
+
+	if len(mockDriver.logs) != 0 {
+		t.Errorf("wanted debug summary filtered at info level, got %v", mockDriver.logs)
+	}
+
+	invalid := LogLevel(42)
+	if err := validateConfig(Config{Name: "x", Config: []byte(`""`), Transactions: TransactionConfig{SummaryLevel: &invalid}}); err == nil {
+		t.Error("wanted error for invalid summary level")
+	}
+}
+
+func debugMessages(logs []Log) []string {
+	var messages []string
+	for _, log := range logs {
+		if log.Level == DebugLevel {
+			messages = append(messages, log.Message)
+		}
+	}
+	return messages
+}
+
+func TestTransactionBufferingSuccess(t *testing.T) {
+	logger, mockDriver := newTransactionTestLogger(Config{
+		LogLevel:     DebugLevel,
+		Transactions: TransactionConfig{Buffering: true},
+	})
+
+	transactionID := logger.StartTransaction()
+	logger.Debug("held", nil, transactionID)
+	logger.Info("sent right away", nil, transactionID)
+	logger.Debug("not in a transaction", nil)
+
+	if len(mockDriver.logs) != 2 {
+		t.Fatalf("wanted only non-held entries sent, got %v", mockDriver.logs)
+	}
+	if held := logger.transactions[transactionID].Logs; len(held) != 2 {
+		t.Errorf("wanted entries kept in Transaction.Logs, got %d", len(held))
+	}
+
+	logger.EndTransaction(transactionID)
+
+	if messages := debugMessages(mockDriver.logs); len(messages) != 1 || messages[0] != "not in a transaction" {
+		t.Errorf("wanted held debug entry dropped on success, got %v", messages)
+	}
+	if summary := mockDriver.logs[len(mockDriver.logs)-1]; summary.Values()["debug_released"] != false {
+		t.Errorf("wanted debug_released=false in summary, got %v", summary.Values()["debug_released"])
+	}
+}
+
+func TestTransactionBufferingFailure(t *testing.T) {
+	logger, mockDriver := newTransactionTestLogger(Config{
+		LogLevel:     InfoLevel,
+		Transactions: TransactionConfig{Buffering: true},
+	})
+
+	transactionID := logger.StartTransaction()
+	logger.Debug("detail", nil, transactionID)
+	logger.Error("it broke", nil, transactionID)
+	logger.EndTransaction(transactionID)
+
+	if messages := debugMessages(mockDriver.logs); len(messages) != 1 || messages[0] != "detail" {
+		t.Errorf("wanted held debug entry released on error even below log level, got %v", messages)
+	}
+
+	transactionID = logger.StartTransaction()
+	logger.Debug("outcome detail", nil, transactionID)
+	logger.EndTransactionWithTags(transactionID, map[string]string{"outcome": "failure"})
+
+	if messages := debugMessages(mockDriver.logs); len(messages) != 2 {
+		t.Errorf("wanted held debug entry released on failure outcome, got %v", messages)
+	}
+}
+
+func TestTransactionBufferingLatency(t *testing.T) {
+	logger, mockDriver := newTransactionTestLogger(Config{
+		LogLevel:     DebugLevel,
+		Transactions: TransactionConfig{Buffering: true, LatencyThreshold: JSONDuration(5 * time.Millisecond)},
+	})
+
+	transactionID := logger.StartTransaction()
+	logger.Debug("slow detail", nil, transactionID)
+	time.Sleep(10 * time.Millisecond)
+	logger.EndTransaction(transactionID)
+
+	if messages := debugMessages(mockDriver.logs); len(messages) != 1 {
+		t.Errorf("wanted held debug entry released for slow transaction, got %v", messages)
+	}
+}
+
+func TestNestedTransactions(t *testing.T) {
+	logger, mockDriver := newTransactionTestLogger(Config{LogLevel: DebugLevel})
+
+	root := logger.StartTransaction()
+	child := logger.StartTransaction(root)
+	grandchild := logger.StartTransaction(child)
+
+	logger.Info("in grandchild", nil, grandchild)
+
+	log := mockDriver.logs[0]
+	if log.TransactionID != grandchild || log.ParentID != child || log.TraceID != root {
+		t.Errorf("wanted grandchild %s with parent %s in trace %s, got %+v", grandchild, child, root, log)
+	}
+
+	if err := logger.EndTransaction(grandchild); err != nil {
+		t.Fatalf("endtransaction returned error: %v", err)
+	}
+	ended := mockDriver.logs[len(mockDriver.logs)-1]
+	spanID := log.SpanID
+	if ended.ParentID != child || ended.TraceID != root || ended.SpanID != spanID || spanID == "" {
+		t.Errorf("wanted summary with parent %s, trace %s and span %s, got %+v", child, root, spanID, ended)
+	}
+
+	if err := logger.EndTransaction(root); err != nil {
+		t.Fatalf("endtransaction returned error: %v", err)
+	}
+
+	summary := mockDriver.logs[len(mockDriver.logs)-1].Values()
+	if summary["open_children"] != int64(1) || summary["open_children_ids"] != child {
+		t.Errorf("wanted open child %s reported, got %v", child, summary)
+	}
+
+	if err := logger.EndTransaction(child); err != nil {
+		t.Fatalf("ending a child after its parent returned error: %v", err)
+	}
+	if summary := mockDriver.logs[len(mockDriver.logs)-1].Values(); summary["open_children"] != nil {
+		t.Errorf("wanted no open children for child, got %v", summary["open_children"])
+	}
+}
+
+func TestNestedTransactionContext(t *testing.T) {
+	logger, _ := newTransactionTestLogger(Config{LogLevel: DebugLevel})
+
+	ctx, root := logger.StartTransactionContext(context.Background())
+	_, child := logger.StartTransactionContext(ctx)
+
+	transaction := logger.transactions[child]
+	if transaction.ParentID != root || transaction.TraceID != root {
+		t.Errorf("wanted child of %s, got parent %s trace %s", root, transaction.ParentID, transaction.TraceID)
+	}
+}
+
+func TestReapStaleTransactions(t *testing.T) {
+	logger, mockDriver := newTransactionTestLogger(Config{LogLevel: DebugLevel})
+
+	stale := logger.StartTransaction()
+	logger.transactions[stale].Start = time.Now().Add(-time.Hour)
+	fresh := logger.StartTransaction()
+
+	if logger.OpenTransactions() != 2 {
+		t.Fatalf("wanted 2 open transactions, got %d", logger.OpenTransactions())
+	}
+
+	logger.reap(time.Minute)
+
+	if _, ok := logger.transactions[fresh]; !ok || logger.OpenTransactions() != 1 {
+		t.Errorf("wanted only the fresh transaction left, got %d open", logger.OpenTransactions())
+	}
+
+	log := mockDriver.logs[len(mockDriver.logs)-1]
+	if log.Level != WarningLevel || log.TransactionID != stale || log.Tags["timed_out"] != "true" {
+		t.Errorf("wanted timed out warning for %s, got %+v", stale, log)
+	}
+
+	if err := logger.EndTransaction(stale); err == nil {
+		t.Error("wanted error ending a reaped transaction")
+	}
+}
+
+func TestReapReportsDriverErrors(t *testing.T) {
+	logger, _ := newTransactionTestLogger(Config{LogLevel: DebugLevel})
+	logger.driver = &FailingDriver{failures: 1, err: errors.New("backend down")}
+	var handled []error
+	logger.SetErrorHandler(func(err error) {
+		handled = append(handled, err)
+	})
+
+	stale := logger.StartTransaction()
+	logger.transactions[stale].Start = time.Now().Add(-time.Hour)
+	logger.reap(time.Minute)
+
+	if len(handled) != 1 || handled[0].Error() != "backend down" {
+		t.Errorf("wanted the driver error of the timed out warning reported, got %v", handled)
+	}
+
+	// ending a transaction that is already gone is not reported
+	if err := logger.endTransaction(stale, nil, true); !errors.Is(err, errTransactionNotFound) {
+		t.Errorf("wanted errtransactionnotfound, got %v", err)
+	}
+}
+
+func TestReaperRunsInBackground(t *testing.T) {
+	err := RegisterDriver("mockReaper", func(config json.RawMessage) (Driver, error) {
+		return &MockDriver{}, nil
+	})
+	if err != nil {
+		t.Fatalf("registerdriver gave error: %v", err)
+	}
+
+	logger, err := NewLogger(Config{
+		Name:         "mockReaper",
+		Transactions: TransactionConfig{MaxAge: JSONDuration(10 * time.Millisecond)},
+	})
+	if err != nil {
+		t.Fatalf("newlogger returned error: %v", err)
+	}
+	defer logger.Close()
+
+	logger.StartTransaction()
+
+	deadline := time.Now().Add(time.Second)
+	for logger.OpenTransactions() > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if logger.OpenTransactions() != 0 {
+		t.Error("wanted abandoned transaction reaped")
+	}
+}
@@ -0,0 +1,236 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ConfigError is a problem with one value of a config. Path is the JSON
+// path of the value, like "driver_config.drivers[0].host".
+type ConfigError struct {
+	Path    string
+	Message string
+}
+
+func (e *ConfigError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// ConfigErrors lists every problem found in a config.
+type ConfigErrors []*ConfigError
+
+func (e ConfigErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("config validation failed: %s", strings.Join(messages, "; "))
+}
+
+// Add records a problem with the value at path.
+func (e *ConfigErrors) Add(path, format string, args ...any) {
+	*e = append(*e, &ConfigError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// Within returns the errors with their paths moved under path, for errors
+// of a nested config.
+func (e ConfigErrors) Within(path string) ConfigErrors {
+	within := make(ConfigErrors, len(e))
+	for i, err := range e {
+		within[i] = &ConfigError{Path: joinPath(path, err.Path), Message: err.Message}
+	}
+	return within
+}
+
+// Err returns nil when there are no errors, so the result can be returned
+// as an error.
+func (e ConfigErrors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+func joinPath(path, child string) string {
+	switch {
+	case path == "":
+		return child
+	case child == "":
+		return path
+	case strings.HasPrefix(child, "["):
+		return path + child
+	}
+	return path + "." + child
+}
+
+var plainKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// keyPath is the path of a key in the object at path. Keys that aren't
+// plain words are quoted, like components["db.*"].
+func keyPath(path, key string) string {
+	if plainKey.MatchString(key) {
+		return joinPath(path, key)
+	}
+	return path + "[" + strconv.Quote(key) + "]"
+}
+
+// asConfigErrors keeps the paths of ConfigErrors, other errors are reported
+// for the whole value.
+func asConfigErrors(err error) ConfigErrors {
+	var configErrors ConfigErrors
+	if errors.As(err, &configErrors) {
+		return configErrors
+	}
+	var configError *ConfigError
+	if errors.As(err, &configError) {
+		return ConfigErrors{configError}
+	}
+	return ConfigErrors{{Message: err.Error()}}
+}
+
+// DriverValidator checks a driver_config without creating the driver. It
+// returns ConfigErrors with paths inside the driver_config, other errors
+// are reported for the driver_config as a whole.
+type DriverValidator func(config json.RawMessage) error
+
+var registeredValidators = make(map[string]DriverValidator)
+
+// RegisterDriverValidator adds a check of the driver_config of a registered
+// driver. LoadConfig and ApplyConfig run it with the other checks, so
+// mistakes are reported before the driver is created.
+func RegisterDriverValidator(name string, validator DriverValidator) error {
+	if _, ok := registeredDrivers[name]; !ok {
+		return fmt.Errorf("unknown driver: %s", name)
+	}
+	if _, ok := registeredValidators[name]; ok {
+		return fmt.Errorf("driver validator already registered: %s", name)
+	}
+	registeredValidators[name] = validator
+	return nil
+}
+
+// ValidateDriverConfig runs the validator registered for a driver, drivers
+// that wrap other drivers use it for their children. Drivers without a
+// validator are not checked.
+func ValidateDriverConfig(name string, config json.RawMessage) ConfigErrors {
+	validator, ok := registeredValidators[name]
+	if !ok {
+		return nil
+	}
+	if err := validator(config); err != nil {
+		return asConfigErrors(err)
+	}
+	return nil
+}
+
+// DecodeStrict decodes config into v like json.Unmarshal, but fields that v
+// doesn't have are an error, like with DisallowUnknownFields. All unknown
+// fields are reported as ConfigErrors with their paths, not only the first.
+func DecodeStrict(config json.RawMessage, v any) error {
+	decodeErr, unknown := decodeStrict(config, v)
+	if decodeErr != nil {
+		unknown = append(ConfigErrors{decodeErr}, unknown...)
+	}
+	return unknown.Err()
+}
+
+func decodeStrict(config json.RawMessage, v any) (*ConfigError, ConfigErrors) {
+	var decodeErr *ConfigError
+	if err := json.Unmarshal(config, v); err != nil {
+		decodeErr = decodeError(err)
+	}
+
+	var unknown ConfigErrors
+	var generic any
+	if json.Unmarshal(config, &generic) == nil {
+		unknownFields(generic, reflect.TypeOf(v), "", &unknown)
+	}
+	return decodeErr, unknown
+}
+
+func decodeError(err error) *ConfigError {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		// the field path has array indexes as plain parts, like servers.0.host
+		var path string
+		for _, part := range strings.Split(typeErr.Field, ".") {
+			if _, err := strconv.Atoi(part); err == nil {
+				path += "[" + part + "]"
+			} else {
+				path = joinPath(path, part)
+			}
+		}
+		return &ConfigError{Path: path, Message: fmt.Sprintf("expected %s, got %s", typeErr.Type, typeErr.Value)}
+	}
+	return &ConfigError{Message: err.Error()}
+}
+
+// unknownFields reports the keys of objects in value that t has no field
+// for, at any depth.
+func unknownFields(value any, t reflect.Type, path string, errs *ConfigErrors) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == rawMessageType {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		// structs that also accept a plain string aren't objects here
+		object, ok := value.(map[string]any)
+		if !ok {
+			return
+		}
+		fields := make(map[string]reflect.Type)
+		eachJSONField(t, func(name string, field reflect.StructField) {
+			fields[name] = field.Type
+		})
+		for _, key := range objectKeys(object) {
+			child := object[key]
+			fieldType, ok := fields[key]
+			if !ok {
+				// encoding/json matches field names case insensitively
+				for name, candidate := range fields {
+					if strings.EqualFold(name, key) {
+						fieldType, ok = candidate, true
+						break
+					}
+				}
+			}
+			if !ok {
+				errs.Add(keyPath(path, key), "unknown field")
+				continue
+			}
+			unknownFields(child, fieldType, keyPath(path, key), errs)
+		}
+	case reflect.Map:
+		object, _ := value.(map[string]any)
+		for _, key := range objectKeys(object) {
+			unknownFields(object[key], t.Elem(), keyPath(path, key), errs)
+		}
+	case reflect.Slice, reflect.Array:
+		array, _ := value.([]any)
+		for i, child := range array {
+			unknownFields(child, t.Elem(), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	}
+}
+
+func objectKeys(object map[string]any) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
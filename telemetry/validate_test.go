@@ -0,0 +1,117 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func configErrorPaths(t *testing.T, err error) []string {
+	t.Helper()
+	var configErrors ConfigErrors
+	if !errors.As(err, &configErrors) {
+		t.Fatalf("wanted ConfigErrors, got %v", err)
+	}
+	var paths []string
+	for _, configError := range configErrors {
+		paths = append(paths, configError.Path)
+	}
+	return paths
+}
+
+func TestDecodeStrict(t *testing.T) {
+	type server struct {
+		Host string `json:"host"`
+	}
+	type config struct {
+		FormatConfig
+		Name    string            `json:"name"`
+		Servers []server          `json:"servers"`
+		Tags    map[string]server `json:"tags"`
+		Raw     json.RawMessage   `json:"raw"`
+	}
+
+	var cfg config
+	err := DecodeStrict(json.RawMessage(`{
+		"NAME": "case insensitive",
+		"format": "json",
+		"nmae": "typo",
+		"servers": [{"host": "a"}, {"hots": "b"}],
+		"tags": {"db.primary": {"port": 1}},
+		"raw": {"anything": true}
+	}`), &cfg)
+
+	want := []string{"nmae", "servers[1].hots", `tags["db.primary"].port`}
+	if paths := configErrorPaths(t, err); !reflect.DeepEqual(paths, want) {
+		t.Errorf("wanted paths %v, got %v", want, paths)
+	}
+	if cfg.Name != "case insensitive" || cfg.Format != "json" || cfg.Servers[0].Host != "a" {
+		t.Errorf("wanted known fields decoded, got %+v", cfg)
+	}
+
+	err = DecodeStrict(json.RawMessage(`{"servers": [{"host": 1}]}`), &cfg)
+	if paths := configErrorPaths(t, err); !reflect.DeepEqual(paths, []string{"servers[0].host"}) {
+		t.Errorf("wanted the path of the type error, got %v", err)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	RegisterDriver("testValidated", func(config json.RawMessage) (Driver, error) {
+		return &MockDriver{}, nil
+	})
+	RegisterDriverValidator("testValidated", func(config json.RawMessage) error {
+		var cfg struct {
+			Host string `json:"host"`
+		}
+		if err := DecodeStrict(config, &cfg); err != nil {
+			return err
+		}
+		if cfg.Host == "" {
+			return &ConfigError{Path: "host", Message: "host required"}
+		}
+		return nil
+	})
+
+	if err := RegisterDriverValidator("testValidated", nil); err == nil {
+		t.Error("wanted error registering a validator twice")
+	}
+	if err := RegisterDriverValidator("testValidatedMissing", nil); err == nil {
+		t.Error("wanted error registering a validator for an unknown driver")
+	}
+
+	filename := filepath.Join(t.TempDir(), "config.json")
+	content := `{
+		"driver": "testValidated",
+		"driver_config": {"usrname": "elastic"},
+		"log_levle": "debug",
+		"components": {"db.*": 42},
+		"buffer": {"qeue_size": 10},
+		"retry": {"jitter": 2, "dead_letter": {"driver": "testValidated", "driver_config": {"host": "x"}}}
+	}`
+	if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := LoadConfig(filename)
+	want := []string{
+		"buffer.qeue_size",
+		"log_levle",
+		"driver_config.usrname",
+		`components["db.*"]`,
+		"retry.jitter",
+	}
+	if paths := configErrorPaths(t, err); !reflect.DeepEqual(paths, want) {
+		t.Errorf("wanted paths %v, got %v", want, paths)
+	}
+
+	if err := os.WriteFile(filename, []byte(`{"driver": "testValidated", "driver_config": {}, "buffer": {"queue_size": "ten"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadConfig(filename)
+	if paths := configErrorPaths(t, err); !reflect.DeepEqual(paths, []string{"buffer.queue_size"}) {
+		t.Errorf("wanted the decode error with its path only, got %v", err)
+	}
+}
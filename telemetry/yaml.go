@@ -0,0 +1,155 @@
+package telemetry
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlToJSON converts a YAML config file to JSON. Aliases and merge keys
+// are resolved, tags other than the core schema ones and more than one
+// document are reported with their line.
+func yamlToJSON(data []byte) ([]byte, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+
+	var document yaml.Node
+	if err := decoder.Decode(&document); err != nil {
+		if errors.Is(err, io.EOF) {
+			return []byte("null"), nil
+		}
+		return nil, &ConfigError{Message: err.Error()}
+	}
+
+	var next yaml.Node
+	if err := decoder.Decode(&next); err == nil {
+		return nil, yamlError(&next, "multiple documents are not supported")
+	} else if !errors.Is(err, io.EOF) {
+		return nil, &ConfigError{Message: err.Error()}
+	}
+
+	value, err := yamlValue(&document)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+func yamlError(node *yaml.Node, format string, args ...any) *ConfigError {
+	return &ConfigError{Message: fmt.Sprintf("yaml: line %d: %s", node.Line, fmt.Sprintf(format, args...))}
+}
+
+func yamlValue(node *yaml.Node) (any, error) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+		return yamlValue(node.Content[0])
+	case yaml.AliasNode:
+		return yamlValue(node.Alias)
+	case yaml.MappingNode:
+		if tag := node.ShortTag(); tag != "!!map" {
+			return nil, yamlError(node, "tag %s is not supported", tag)
+		}
+		object := make(map[string]any, len(node.Content)/2)
+		lines := make(map[string]int, len(node.Content)/2)
+		var merged []map[string]any
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			if key.Kind != yaml.ScalarNode {
+				return nil, yamlError(key, "keys must be scalars")
+			}
+			if key.ShortTag() == "!!merge" {
+				objects, err := yamlMerge(node.Content[i+1])
+				if err != nil {
+					return nil, err
+				}
+				merged = append(merged, objects...)
+				continue
+			}
+			if _, err := yamlValue(key); err != nil {
+				return nil, err
+			}
+			if line, ok := lines[key.Value]; ok {
+				return nil, yamlError(key, "duplicate key %q, first defined on line %d", key.Value, line)
+			}
+			lines[key.Value] = key.Line
+
+			value, err := yamlValue(node.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			object[key.Value] = value
+		}
+		// keys of the mapping itself win over merged ones, and earlier
+		// merged mappings over later ones
+		for _, merge := range merged {
+			for key, value := range merge {
+				if _, ok := object[key]; !ok {
+					object[key] = value
+				}
+			}
+		}
+		return object, nil
+	case yaml.SequenceNode:
+		if tag := node.ShortTag(); tag != "!!seq" {
+			return nil, yamlError(node, "tag %s is not supported", tag)
+		}
+		array := make([]any, len(node.Content))
+		for i, child := range node.Content {
+			value, err := yamlValue(child)
+			if err != nil {
+				return nil, err
+			}
+			array[i] = value
+		}
+		return array, nil
+	case yaml.ScalarNode:
+		switch tag := node.ShortTag(); tag {
+		case "!!str", "!!timestamp":
+			// timestamps have no JSON type, they stay as written
+			return node.Value, nil
+		case "!!null":
+			return nil, nil
+		case "!!bool", "!!int", "!!float":
+			var value any
+			if err := node.Decode(&value); err != nil {
+				return nil, yamlError(node, "%v", err)
+			}
+			if number, ok := value.(float64); ok && (math.IsInf(number, 0) || math.IsNaN(number)) {
+				return nil, yamlError(node, "%s can't be represented in JSON", node.Value)
+			}
+			return value, nil
+		default:
+			return nil, yamlError(node, "tag %s is not supported", tag)
+		}
+	}
+	return nil, yamlError(node, "unexpected node")
+}
+
+// yamlMerge returns the mappings of a << key, a mapping or a list of them.
+func yamlMerge(node *yaml.Node) ([]map[string]any, error) {
+	nodes := []*yaml.Node{node}
+	if node.Kind == yaml.SequenceNode {
+		nodes = node.Content
+	}
+
+	objects := make([]map[string]any, len(nodes))
+	for i, child := range nodes {
+		value, err := yamlValue(child)
+		if err != nil {
+			return nil, err
+		}
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil, yamlError(child, "merge key needs a mapping or a list of mappings")
+		}
+		objects[i] = object
+	}
+	return objects, nil
+}
@@ -0,0 +1,148 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func decodeJSON(t *testing.T, data []byte) any {
+	t.Helper()
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		t.Fatalf("converted document isn't valid json: %v\n%s", err, data)
+	}
+	return value
+}
+
+func TestYAMLToJSON(t *testing.T) {
+	document := `
+# telemetry config
+---
+driver: multi
+driver_config:
+  drivers:
+    - driver: console
+      driver_config: {color: never, layout: "time level message"}
+      log_level: debug
+    - driver: elasticsearch
+      driver_config:
+        host: http://localhost:9200   # not a comment: http://x#y
+        password: ${ES_PASSWORD}
+      log_level: warning
+log_level: 1
+default_tags:
+  app_version: "1.0.0"
+  go_version: '1.22'
+  note: it's "quoted" inside
+  escaped: "tab\there \u00e9"
+  empty: ""
+transactions:
+  buffering: true
+  latency_threshold: 500ms
+  summary_level: ~
+list:
+- 1
+- -2.5
+- [a, 'b, c', {x: 1}]
+- - nested
+  - sequence
+literal: |
+  line one
+    indented
+
+  line three
+folded: >-
+  folded
+  text
+`
+	data, err := yamlToJSON([]byte(document))
+	if err != nil {
+		t.Fatalf("yamltojson returned error: %v", err)
+	}
+
+	want := decodeJSON(t, []byte(`{
+		"driver": "multi",
+		"driver_config": {"drivers": [
+			{"driver": "console", "driver_config": {"color": "never", "layout": "time level message"}, "log_level": "debug"},
+			{"driver": "elasticsearch", "driver_config": {"host": "http://localhost:9200", "password": "${ES_PASSWORD}"}, "log_level": "warning"}
+		]},
+		"log_level": 1,
+		"default_tags": {"app_version": "1.0.0", "go_version": "1.22", "note": "it's \"quoted\" inside", "escaped": "tab\there é", "empty": ""},
+		"transactions": {"buffering": true, "latency_threshold": "500ms", "summary_level": null},
+		"list": [1, -2.5, ["a", "b, c", {"x": 1}], ["nested", "sequence"]],
+		"literal": "line one\n  indented\n\nline three\n",
+		"folded": "folded text"
+	}`))
+	if got := decodeJSON(t, data); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected conversion\n got: %v\nwant: %v", got, want)
+	}
+}
+
+func TestYAMLErrors(t *testing.T) {
+	tests := map[string]string{
+		"a: 1\nb: 2\na: 3":      "line 3: duplicate key \"a\", first defined on line 1",
+		"a:\n\tb: 1":            "line 2: found character that cannot start any token",
+		"a: 1\n  b: 2":          "line 2: mapping values are not allowed",
+		"a: [1, 2":              "line 1: did not find expected ',' or ']'",
+		"x: 1\nref: *a":         "unknown anchor",
+		"x: &a 1\ny:\n  <<: *a": "line 3: merge key needs a mapping or a list of mappings",
+		"a: !env HOME":          "line 1: tag !env is not supported",
+		"a: !!binary aGk=":      "line 1: tag !!binary is not supported",
+		"a: !!set {x}":          "line 1: tag !!set is not supported",
+		"a: .inf":               "line 1: .inf can't be represented in JSON",
+		"a: 1\n---\nb: 2":       "line 2: multiple documents are not supported",
+		"[a, b]: 1":             "line 1: keys must be scalars",
+	}
+	for document, want := range tests {
+		_, err := yamlToJSON([]byte(document))
+		var configErr *ConfigError
+		if !errors.As(err, &configErr) || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: wanted config error containing %q, got %v", document, want, err)
+		}
+	}
+}
+
+func TestYAMLTags(t *testing.T) {
+	data, err := yamlToJSON([]byte("a: !!str 5\nb: !!int \"7\"\nc: !!map {x: !!null ~}\nd: 2001-12-14\n"))
+	if err != nil {
+		t.Fatalf("yamltojson returned error: %v", err)
+	}
+	want := decodeJSON(t, []byte(`{"a": "5", "b": 7, "c": {"x": null}, "d": "2001-12-14"}`))
+	if got := decodeJSON(t, data); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected conversion\n got: %v\nwant: %v", got, want)
+	}
+}
+
+func TestYAMLAnchors(t *testing.T) {
+	document := `
+base: &base
+  driver: console
+  driver_config: &console {color: never}
+  log_level: info
+tags: &tags {app: checkout}
+production:
+  <<: [*base, {log_level: error, driver: json}]
+  log_level: warning
+  default_tags: *tags
+staging:
+  <<: *base
+  driver_config: *console
+`
+	data, err := yamlToJSON([]byte(document))
+	if err != nil {
+		t.Fatalf("yamltojson returned error: %v", err)
+	}
+
+	want := decodeJSON(t, []byte(`{
+		"base": {"driver": "console", "driver_config": {"color": "never"}, "log_level": "info"},
+		"tags": {"app": "checkout"},
+		"production": {"driver": "console", "driver_config": {"color": "never"}, "log_level": "warning", "default_tags": {"app": "checkout"}},
+		"staging": {"driver": "console", "driver_config": {"color": "never"}, "log_level": "info"}
+	}`))
+	if got := decodeJSON(t, data); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected conversion\n got: %v\nwant: %v", got, want)
+	}
+}